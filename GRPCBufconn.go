@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const bufconnBufferSize = 1024 * 1024
+
+// bufconnAddress is the target used by clients of a BufconnHarness. The
+// passthrough scheme stops the default dns resolver from trying to resolve
+// it, and the host matches the test certificates for SecurityLevel > 0.
+const bufconnAddress = "passthrough:///localhost"
+
+// BufconnHarness runs a gRPC server built with GetGRPCServer on an in-memory
+// listener and provides a client built with GetGRPCClient that is connected to it.
+// No ports are bound, so tests using it can safely run in parallel.
+type BufconnHarness struct {
+	Server   *grpc.Server
+	Conn     *grpc.ClientConn
+	listener *bufconn.Listener
+	serveErr chan error
+	once     sync.Once
+	closeErr error
+}
+
+// NewBufconnHarness creates a server with serverOptions, calls register so that
+// the caller can register its services, starts serving and then dials it with
+// clientOptions. All interceptors configured by the options are applied on both
+// sides exactly as they would be over a real network connection.
+// Close must be called to release the server and the client connection.
+func NewBufconnHarness(ctx context.Context, serverOptions *ConnectionOptions, clientOptions *ConnectionOptions, register func(srv *grpc.Server)) (*BufconnHarness, error) {
+	srv, err := GetGRPCServer(serverOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if register != nil {
+		register(srv)
+	}
+
+	h := &BufconnHarness{
+		Server:   srv,
+		listener: bufconn.Listen(bufconnBufferSize),
+		serveErr: make(chan error, 1),
+	}
+
+	go func() {
+		h.serveErr <- srv.Serve(h.listener)
+	}()
+
+	opts := append(clientOptions.AsClientOptions(), WithDialOptions(grpc.WithContextDialer(h.dial)))
+
+	conn, err := NewGRPCClient(ctx, bufconnAddress, opts...)
+	if err != nil {
+		srv.Stop()
+		return nil, err
+	}
+
+	h.Conn = conn
+
+	return h, nil
+}
+
+func (h *BufconnHarness) dial(ctx context.Context, _ string) (net.Conn, error) {
+	return h.listener.DialContext(ctx)
+}
+
+// Close closes the client connection and stops the server.
+// It returns the error returned by Serve, if any. Calling Close more than once
+// returns the same error.
+func (h *BufconnHarness) Close() error {
+	h.once.Do(func() {
+		if h.Conn != nil {
+			_ = h.Conn.Close()
+		}
+
+		h.Server.Stop()
+
+		h.closeErr = <-h.serveErr
+	})
+
+	return h.closeErr
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// DefaultChunkSize is the chunk size used by SendChunked when chunkSize is 0.
+const DefaultChunkSize = 1024 * 1024
+
+// maxChunkedPreallocation bounds the buffer allocated up front by ReceiveChunked,
+// since the total size announced by the sender cannot be trusted.
+const maxChunkedPreallocation = 16 * DefaultChunkSize
+
+// Chunk is one part of a payload sent by SendChunked.
+// Map its fields onto the message type of your stream, for example:
+//
+//	message Chunk {
+//	  uint32 index = 1;
+//	  uint64 total_size = 2;
+//	  bytes data = 3;
+//	  bytes checksum = 4;
+//	}
+type Chunk struct {
+	Index     uint32 // Position of the chunk in the payload, starting at 0
+	TotalSize uint64 // Size of the whole payload in bytes
+	Data      []byte // The bytes of this chunk
+	Checksum  []byte // Sha256d of the whole payload, only set on the last chunk
+}
+
+// IsLast reports whether this is the final chunk of the payload.
+func (c *Chunk) IsLast() bool {
+	return len(c.Checksum) > 0
+}
+
+// SendChunked splits payload into chunks of at most chunkSize bytes and calls send
+// for each of them in order. The last chunk carries the Sha256d checksum of the
+// whole payload so that ReceiveChunked can verify it. An empty payload is sent as
+// a single empty chunk.
+func SendChunked(payload []byte, chunkSize int, send func(chunk *Chunk) error) error {
+	if chunkSize < 0 {
+		return errors.New("chunkSize must not be negative")
+	}
+
+	if chunkSize == 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	totalSize := uint64(len(payload))
+	checksum := Sha256d(payload)
+
+	var index uint32
+
+	for offset := 0; ; offset += chunkSize {
+		end := offset + chunkSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+
+		chunk := &Chunk{
+			Index:     index,
+			TotalSize: totalSize,
+			Data:      payload[offset:end],
+		}
+
+		if end == len(payload) {
+			chunk.Checksum = checksum
+		}
+
+		if err := send(chunk); err != nil {
+			return fmt.Errorf("failed to send chunk %d: %w", index, err)
+		}
+
+		if chunk.IsLast() {
+			return nil
+		}
+
+		index++
+	}
+}
+
+// ReceiveChunked calls recv until the last chunk of a payload sent with SendChunked
+// has been received, and returns the reassembled payload after checking the chunk
+// order, the total size and the Sha256d checksum. maxSize limits the size of the
+// payload that will be accepted; 0 means no limit.
+func ReceiveChunked(recv func() (*Chunk, error), maxSize uint64) ([]byte, error) {
+	var buf []byte
+
+	var (
+		expectedIndex uint32
+		totalSize     uint64
+	)
+
+	for {
+		chunk, err := recv()
+		if err != nil {
+			return nil, fmt.Errorf("failed to receive chunk %d: %w", expectedIndex, err)
+		}
+
+		if chunk.Index != expectedIndex {
+			return nil, fmt.Errorf("received chunk %d, expected chunk %d", chunk.Index, expectedIndex)
+		}
+
+		if expectedIndex == 0 {
+			if maxSize > 0 && chunk.TotalSize > maxSize {
+				return nil, fmt.Errorf("payload of %d bytes exceeds the maximum of %d bytes", chunk.TotalSize, maxSize)
+			}
+
+			totalSize = chunk.TotalSize
+			buf = make([]byte, 0, min(totalSize, maxChunkedPreallocation))
+		} else if chunk.TotalSize != totalSize {
+			return nil, fmt.Errorf("chunk %d has a total size of %d bytes, expected %d bytes", chunk.Index, chunk.TotalSize, totalSize)
+		}
+
+		if uint64(len(buf)+len(chunk.Data)) > totalSize {
+			return nil, fmt.Errorf("received more than the expected %d bytes", totalSize)
+		}
+
+		buf = append(buf, chunk.Data...)
+
+		if chunk.IsLast() {
+			if uint64(len(buf)) != totalSize {
+				return nil, fmt.Errorf("received %d bytes, expected %d bytes", len(buf), totalSize)
+			}
+
+			if !bytes.Equal(Sha256d(buf), chunk.Checksum) {
+				return nil, errors.New("checksum mismatch")
+			}
+
+			return buf, nil
+		}
+
+		expectedIndex++
+	}
+}
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func chunkPipe(t *testing.T, payload []byte, chunkSize int) []*Chunk {
+	var chunks []*Chunk
+
+	err := SendChunked(payload, chunkSize, func(chunk *Chunk) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	require.NoError(t, err)
+
+	return chunks
+}
+
+func recvFrom(chunks []*Chunk) func() (*Chunk, error) {
+	return func() (*Chunk, error) {
+		if len(chunks) == 0 {
+			return nil, io.EOF
+		}
+
+		chunk := chunks[0]
+		chunks = chunks[1:]
+
+		return chunk, nil
+	}
+}
+
+func TestChunkedRoundTrip(t *testing.T) {
+	payload := make([]byte, 10_000)
+	_, _ = rand.Read(payload)
+
+	chunks := chunkPipe(t, payload, 1024)
+	assert.Len(t, chunks, 10)
+	assert.True(t, chunks[9].IsLast())
+
+	received, err := ReceiveChunked(recvFrom(chunks), 0)
+	require.NoError(t, err)
+	assert.Equal(t, payload, received)
+}
+
+func TestChunkedEmptyPayload(t *testing.T) {
+	chunks := chunkPipe(t, nil, 1024)
+	assert.Len(t, chunks, 1)
+
+	received, err := ReceiveChunked(recvFrom(chunks), 0)
+	require.NoError(t, err)
+	assert.Empty(t, received)
+}
+
+func TestChunkedIntegrity(t *testing.T) {
+	payload := []byte("The quick brown fox jumps over the lazy dog")
+
+	chunks := chunkPipe(t, payload, 10)
+
+	corrupted := append([]byte{}, chunks[1].Data...)
+	corrupted[0] ^= 0xff
+	chunks[1] = &Chunk{Index: 1, TotalSize: chunks[1].TotalSize, Data: corrupted}
+
+	_, err := ReceiveChunked(recvFrom(chunks), 0)
+	assert.EqualError(t, err, "checksum mismatch")
+
+	chunks = chunkPipe(t, payload, 10)
+	_, err = ReceiveChunked(recvFrom(append(chunks[:1], chunks[2:]...)), 0)
+	assert.Error(t, err)
+
+	_, err = ReceiveChunked(recvFrom(chunkPipe(t, payload, 10)), 10)
+	assert.Error(t, err)
+
+	chunks = chunkPipe(t, payload, 10)
+	_, err = ReceiveChunked(recvFrom(chunks[:2]), 0)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestChunkedUntrustedTotalSize(t *testing.T) {
+	// A huge announced size must not be preallocated
+	chunks := []*Chunk{{Index: 0, TotalSize: 1 << 62, Data: []byte("abc")}, {Index: 1, TotalSize: 1 << 62, Data: []byte("def"), Checksum: []byte{1}}}
+
+	_, err := ReceiveChunked(recvFrom(chunks), 0)
+	assert.EqualError(t, err, "received 6 bytes, expected 4611686018427387904 bytes")
+
+	// The total size must not change between chunks
+	chunks = chunkPipe(t, []byte("The quick brown fox jumps over the lazy dog"), 10)
+	chunks[2] = &Chunk{Index: 2, TotalSize: 1000, Data: chunks[2].Data}
+
+	_, err = ReceiveChunked(recvFrom(chunks), 0)
+	assert.ErrorContains(t, err, "chunk 2 has a total size of 1000 bytes, expected 43 bytes")
+}
@@ -0,0 +1,334 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// poolKey identifies a pooled connection.
+type poolKey struct {
+	address string
+	key     string
+}
+
+type pooledConn struct {
+	key       poolKey
+	options   *ClientOptions
+	conn      *grpc.ClientConn
+	refs      int
+	idleSince time.Time
+	cancel    context.CancelFunc
+}
+
+// ClientPool caches gRPC client connections keyed by address, and optionally by a
+// caller-supplied key, so that services talking to many peers share one
+// *grpc.ClientConn per peer.
+// Connections are reference counted: every Get must be matched by a Release.
+// Connections with no references are closed once they have been idle for the idle TTL.
+// The pool is safe for concurrent use.
+type ClientPool struct {
+	mu            sync.Mutex
+	opts          []ClientOption
+	idleTTL       time.Duration
+	conns         map[poolKey]*pooledConn
+	byConn        map[*grpc.ClientConn]*pooledConn
+	stateChangeFn func(address string, state connectivity.State)
+	closed        bool
+	done          chan struct{}
+}
+
+// NewClientPool creates a new ClientPool. The given opts are applied to every connection
+// before any options passed to Get. An idleTTL of 0 keeps unreferenced connections open
+// until the pool is closed.
+func NewClientPool(idleTTL time.Duration, opts ...ClientOption) *ClientPool {
+	p := &ClientPool{
+		opts:    opts,
+		idleTTL: idleTTL,
+		conns:   make(map[poolKey]*pooledConn),
+		byConn:  make(map[*grpc.ClientConn]*pooledConn),
+		done:    make(chan struct{}),
+	}
+
+	if idleTTL > 0 {
+		go p.reaper()
+	}
+
+	return p
+}
+
+// WithStateChangeFunction registers a function that is called whenever the connectivity
+// state of a pooled connection changes.
+func (p *ClientPool) WithStateChangeFunction(f func(address string, state connectivity.State)) *ClientPool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.stateChangeFn = f
+	return p
+}
+
+// Get returns a connection to address built with the pool's options, creating it if
+// it is not already in the pool. Connections are shared between all callers of Get
+// for the same address.
+func (p *ClientPool) Get(ctx context.Context, address string) (*grpc.ClientConn, error) {
+	return p.get(ctx, poolKey{address: address}, nil)
+}
+
+// GetWithKey is like Get, but applies opts after the pool's options and shares the
+// connection only between callers that use the same address and key. An error is
+// returned if opts result in different settings than those of the connection
+// already pooled for the address and key. Raw dial options are compared by identity,
+// so callers sharing a key must pass the same grpc.DialOption values. The key must
+// not be empty.
+func (p *ClientPool) GetWithKey(ctx context.Context, address string, key string, opts ...ClientOption) (*grpc.ClientConn, error) {
+	if key == "" {
+		return nil, errors.New("client pool key must not be empty")
+	}
+
+	return p.get(ctx, poolKey{address: address, key: key}, opts)
+}
+
+func (p *ClientPool) get(ctx context.Context, key poolKey, opts []ClientOption) (*grpc.ClientConn, error) {
+	clientOptions, err := NewClientOptions(append(append([]ClientOption{}, p.opts...), opts...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if conn, ok, err := p.acquire(key, clientOptions); ok || err != nil {
+		return conn, err
+	}
+
+	// Dial without holding the lock so that a slow dial does not block other callers
+	conn, err := getGRPCClient(ctx, key.address, clientOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		_ = conn.Close()
+		return nil, errors.New("client pool is closed")
+	}
+
+	// Another caller may have added the same connection while we were dialing
+	if pc, ok := p.conns[key]; ok {
+		_ = conn.Close()
+		return p.reuse(pc, clientOptions)
+	}
+
+	monitorCtx, cancel := context.WithCancel(context.Background())
+
+	pc := &pooledConn{
+		key:     key,
+		options: clientOptions,
+		conn:    conn,
+		refs:    1,
+		cancel:  cancel,
+	}
+
+	p.conns[key] = pc
+	p.byConn[conn] = pc
+
+	go p.monitor(monitorCtx, pc)
+
+	return conn, nil
+}
+
+// acquire returns the pooled connection for key, if there is one, and takes a reference to it.
+func (p *ClientPool) acquire(key poolKey, options *ClientOptions) (*grpc.ClientConn, bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, false, errors.New("client pool is closed")
+	}
+
+	pc, ok := p.conns[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	conn, err := p.reuse(pc, options)
+
+	return conn, true, err
+}
+
+// reuse takes a reference to pc if it was created with the same options. The caller must hold the lock.
+func (p *ClientPool) reuse(pc *pooledConn, options *ClientOptions) (*grpc.ClientConn, error) {
+	if !sameClientOptions(pc.options, options) {
+		return nil, fmt.Errorf("client pool already has a connection to %s with key %q and different options", pc.key.address, pc.key.key)
+	}
+
+	pc.refs++
+
+	return pc.conn, nil
+}
+
+// sameClientOptions reports whether a and b hold the same settings. Raw dial options
+// are compared by identity, as most of them wrap functions that cannot be compared.
+func sameClientOptions(a, b *ClientOptions) bool {
+	if a.CommonOptions != b.CommonOptions || a.MaxRetries != b.MaxRetries || a.RetryBackoff != b.RetryBackoff {
+		return false
+	}
+
+	if !maps.Equal(a.Credentials, b.Credentials) || len(a.DialOptions) != len(b.DialOptions) {
+		return false
+	}
+
+	for i := range a.DialOptions {
+		if !reflect.ValueOf(a.DialOptions[i]).Comparable() || a.DialOptions[i] != b.DialOptions[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Release gives back a connection obtained from Get.
+func (p *ClientPool) Release(conn *grpc.ClientConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pc, ok := p.byConn[conn]
+	if !ok || pc.refs == 0 {
+		return
+	}
+
+	pc.refs--
+
+	if pc.refs == 0 {
+		pc.idleSince = time.Now()
+	}
+}
+
+// WaitForReady waits for conn to become ready, or for the timeout to expire.
+func (p *ClientPool) WaitForReady(ctx context.Context, conn *grpc.ClientConn, timeout time.Duration) error {
+	return WaitForReady(ctx, conn, timeout)
+}
+
+// Len returns the number of connections in the pool.
+func (p *ClientPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.conns)
+}
+
+// Close closes all connections in the pool, regardless of their reference count.
+func (p *ClientPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil
+	}
+
+	p.closed = true
+	close(p.done)
+
+	var errs []error
+
+	for _, pc := range p.conns {
+		if err := p.remove(pc); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// remove closes the connection and removes it from the pool. The caller must hold the lock.
+func (p *ClientPool) remove(pc *pooledConn) error {
+	delete(p.conns, pc.key)
+	delete(p.byConn, pc.conn)
+
+	pc.cancel()
+
+	return pc.conn.Close()
+}
+
+func (p *ClientPool) reaper() {
+	interval := p.idleTTL / 2
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.closeIdle()
+		}
+	}
+}
+
+func (p *ClientPool) closeIdle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, pc := range p.conns {
+		if pc.refs == 0 && time.Since(pc.idleSince) >= p.idleTTL {
+			_ = p.remove(pc)
+		}
+	}
+}
+
+func (p *ClientPool) monitor(ctx context.Context, pc *pooledConn) {
+	state := pc.conn.GetState()
+
+	for {
+		p.mu.Lock()
+		fn := p.stateChangeFn
+		p.mu.Unlock()
+
+		if fn != nil {
+			fn(pc.key.address, state)
+		}
+
+		if !pc.conn.WaitForStateChange(ctx, state) {
+			return
+		}
+
+		state = pc.conn.GetState()
+	}
+}
+
+// WaitForReady triggers a connection attempt on conn if it is idle and waits for it
+// to become ready, or for the timeout to expire. A timeout of 0 waits until ctx is done.
+func WaitForReady(ctx context.Context, conn *grpc.ClientConn, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	conn.Connect()
+
+	for {
+		state := conn.GetState()
+
+		switch state {
+		case connectivity.Ready:
+			return nil
+		case connectivity.Shutdown:
+			return errors.New("connection is shut down")
+		}
+
+		if !conn.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("connection to %s not ready (%s): %w", conn.Target(), state, ctx.Err())
+		}
+	}
+}
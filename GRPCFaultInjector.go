@@ -0,0 +1,288 @@
+package utils
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// FaultRule describes the faults to inject for calls to a method.
+type FaultRule struct {
+	Method              string        // Full method name (e.g. "/greeter.GreeterService/SayHello"), "*" matches all methods
+	Latency             time.Duration // Delay added before the call is handled
+	ErrorCode           codes.Code    // Status code returned when an error is injected, defaults to codes.Unavailable
+	ErrorProbability    float64       // Probability (0.0 - 1.0) of returning ErrorCode instead of handling the call
+	DropProbability     float64       // Probability (0.0 - 1.0) of dropping a stream mid-flight
+	DropAfterMessages   int           // Number of messages sent or received on a stream before it is dropped
+	DropStreamErrorCode codes.Code    // Status code returned when a stream is dropped, defaults to codes.Unavailable
+}
+
+// FaultInjector injects latency, errors and dropped streams into gRPC calls
+// so that the resilience of clients and services can be tested locally.
+// Rules can be changed at runtime and the injector is safe for concurrent use.
+type FaultInjector struct {
+	mu    sync.RWMutex
+	rules map[string]FaultRule
+	rand  *rand.Rand
+}
+
+// NewFaultInjector creates a new FaultInjector with the given rules.
+func NewFaultInjector(rules ...FaultRule) *FaultInjector {
+	f := &FaultInjector{
+		rules: make(map[string]FaultRule),
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())), // nolint:gosec
+	}
+
+	for _, rule := range rules {
+		f.SetRule(rule)
+	}
+
+	return f
+}
+
+// SetRule adds or replaces the rule for rule.Method.
+func (f *FaultInjector) SetRule(rule FaultRule) {
+	if rule.Method == "" {
+		rule.Method = "*"
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.rules[rule.Method] = rule
+}
+
+// RemoveRule removes the rule for the given method.
+func (f *FaultInjector) RemoveRule(method string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.rules, method)
+}
+
+// Clear removes all rules.
+func (f *FaultInjector) Clear() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.rules = make(map[string]FaultRule)
+}
+
+func (f *FaultInjector) ruleFor(method string) (FaultRule, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if rule, ok := f.rules[method]; ok {
+		return rule, true
+	}
+
+	rule, ok := f.rules["*"]
+
+	return rule, ok
+}
+
+func (f *FaultInjector) chance(probability float64) bool {
+	if probability <= 0 {
+		return false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.rand.Float64() < probability
+}
+
+// inject applies the latency and error parts of the rule for method.
+// It returns the matching rule so that stream interceptors can decide whether to drop the stream.
+func (f *FaultInjector) inject(ctx context.Context, method string) (FaultRule, bool, error) {
+	rule, ok := f.ruleFor(method)
+	if !ok {
+		return rule, false, nil
+	}
+
+	if rule.Latency > 0 {
+		select {
+		case <-ctx.Done():
+			return rule, true, status.FromContextError(ctx.Err()).Err()
+		case <-time.After(rule.Latency):
+		}
+	}
+
+	if f.chance(rule.ErrorProbability) {
+		return rule, true, injectedError(rule, method)
+	}
+
+	return rule, true, nil
+}
+
+func (f *FaultInjector) dropAfter(rule FaultRule) int {
+	if !f.chance(rule.DropProbability) {
+		return -1
+	}
+
+	return rule.DropAfterMessages
+}
+
+func injectedError(rule FaultRule, method string) error {
+	code := rule.ErrorCode
+	if code == codes.OK {
+		code = codes.Unavailable
+	}
+
+	return status.Errorf(code, "fault injected for %s", method)
+}
+
+func dropStreamError(rule FaultRule, method string) error {
+	code := rule.DropStreamErrorCode
+	if code == codes.OK {
+		code = codes.Unavailable
+	}
+
+	return status.Errorf(code, "stream dropped by fault injector for %s", method)
+}
+
+// UnaryServerInterceptor returns a server interceptor that injects faults into unary calls.
+func (f *FaultInjector) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if _, _, err := f.inject(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns a server interceptor that injects faults into streaming calls.
+func (f *FaultInjector) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		rule, ok, err := f.inject(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			if after := f.dropAfter(rule); after >= 0 {
+				ss = &faultServerStream{ServerStream: ss, counter: &faultCounter{remaining: after, err: dropStreamError(rule, info.FullMethod)}}
+			}
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+// UnaryClientInterceptor returns a client interceptor that injects faults into unary calls.
+func (f *FaultInjector) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if _, _, err := f.inject(ctx, method); err != nil {
+			return err
+		}
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor returns a client interceptor that injects faults into streaming calls.
+func (f *FaultInjector) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		rule, ok, err := f.inject(ctx, method)
+		if err != nil {
+			return nil, err
+		}
+
+		after := -1
+		if ok {
+			after = f.dropAfter(rule)
+		}
+
+		if after < 0 {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+
+		// The stream is cancelled when it is dropped, so that it does not outlive the drop
+		ctx, cancel := context.WithCancel(ctx)
+
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		return &faultClientStream{ClientStream: cs, counter: &faultCounter{remaining: after, err: dropStreamError(rule, method)}, cancel: cancel}, nil
+	}
+}
+
+// faultCounter counts the messages on a stream and reports when it should be dropped.
+type faultCounter struct {
+	mu        sync.Mutex
+	remaining int
+	err       error
+}
+
+func (c *faultCounter) next() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.remaining <= 0 {
+		return c.err
+	}
+
+	c.remaining--
+
+	return nil
+}
+
+type faultServerStream struct {
+	grpc.ServerStream
+	counter *faultCounter
+}
+
+func (s *faultServerStream) SendMsg(m interface{}) error {
+	if err := s.counter.next(); err != nil {
+		return err
+	}
+
+	return s.ServerStream.SendMsg(m)
+}
+
+func (s *faultServerStream) RecvMsg(m interface{}) error {
+	if err := s.counter.next(); err != nil {
+		return err
+	}
+
+	return s.ServerStream.RecvMsg(m)
+}
+
+type faultClientStream struct {
+	grpc.ClientStream
+	counter *faultCounter
+	cancel  context.CancelFunc
+}
+
+func (s *faultClientStream) SendMsg(m interface{}) error {
+	if err := s.counter.next(); err != nil {
+		s.cancel()
+		return err
+	}
+
+	return s.ClientStream.SendMsg(m)
+}
+
+func (s *faultClientStream) RecvMsg(m interface{}) error {
+	if err := s.counter.next(); err != nil {
+		s.cancel()
+		return err
+	}
+
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		// The stream has ended, so its context can be released
+		s.cancel()
+	}
+
+	return err
+}
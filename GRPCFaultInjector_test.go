@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const faultTestMethod = "/test.Service/Stream"
+
+// fakeStream records the messages sent and received on a stream.
+type fakeStream struct {
+	ctx  context.Context
+	sent int
+	recv int
+}
+
+func (s *fakeStream) Context() context.Context { return s.ctx }
+
+func (s *fakeStream) SendMsg(m interface{}) error {
+	s.sent++
+	return nil
+}
+
+func (s *fakeStream) RecvMsg(m interface{}) error {
+	s.recv++
+	return nil
+}
+
+type fakeServerStream struct {
+	grpc.ServerStream
+	*fakeStream
+}
+
+func (s *fakeServerStream) Context() context.Context    { return s.fakeStream.Context() }
+func (s *fakeServerStream) SendMsg(m interface{}) error { return s.fakeStream.SendMsg(m) }
+func (s *fakeServerStream) RecvMsg(m interface{}) error { return s.fakeStream.RecvMsg(m) }
+
+type fakeClientStream struct {
+	grpc.ClientStream
+	*fakeStream
+}
+
+func (s *fakeClientStream) Context() context.Context    { return s.fakeStream.Context() }
+func (s *fakeClientStream) SendMsg(m interface{}) error { return s.fakeStream.SendMsg(m) }
+func (s *fakeClientStream) RecvMsg(m interface{}) error { return s.fakeStream.RecvMsg(m) }
+
+func TestFaultInjectorDefaultErrorCode(t *testing.T) {
+	f := NewFaultInjector(FaultRule{ErrorProbability: 1})
+
+	var calls int
+
+	_, err := f.UnaryServerInterceptor()(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: faultTestMethod}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls++
+		return nil, nil
+	})
+
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, 0, calls)
+}
+
+func TestFaultInjectorDropsServerStream(t *testing.T) {
+	f := NewFaultInjector(FaultRule{
+		Method:            faultTestMethod,
+		DropProbability:   1,
+		DropAfterMessages: 2,
+	})
+
+	stream := &fakeStream{ctx: context.Background()}
+
+	var sendErr error
+
+	err := f.StreamServerInterceptor()(nil, &fakeServerStream{fakeStream: stream}, &grpc.StreamServerInfo{FullMethod: faultTestMethod}, func(srv interface{}, ss grpc.ServerStream) error {
+		require.NoError(t, ss.RecvMsg(nil))
+		require.NoError(t, ss.SendMsg(nil))
+
+		sendErr = ss.SendMsg(nil)
+
+		return sendErr
+	})
+
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, codes.Unavailable, status.Code(sendErr))
+	assert.Equal(t, 1, stream.recv)
+	assert.Equal(t, 1, stream.sent)
+}
+
+func TestFaultInjectorDropsClientStream(t *testing.T) {
+	f := NewFaultInjector(FaultRule{
+		Method:              faultTestMethod,
+		DropProbability:     1,
+		DropAfterMessages:   1,
+		DropStreamErrorCode: codes.Aborted,
+	})
+
+	stream := &fakeStream{ctx: context.Background()}
+
+	var streamCtx context.Context
+
+	cs, err := f.StreamClientInterceptor()(context.Background(), &grpc.StreamDesc{ServerStreams: true}, nil, faultTestMethod, func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		streamCtx = ctx
+		return &fakeClientStream{fakeStream: stream}, nil
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, cs.SendMsg(nil))
+	require.NoError(t, streamCtx.Err())
+
+	assert.Equal(t, codes.Aborted, status.Code(cs.RecvMsg(nil)))
+	assert.ErrorIs(t, streamCtx.Err(), context.Canceled)
+	assert.Equal(t, codes.Aborted, status.Code(cs.SendMsg(nil)))
+
+	assert.Equal(t, 1, stream.sent)
+	assert.Equal(t, 0, stream.recv)
+}
+
+func TestFaultInjectorKeepsStreamsWithoutDrops(t *testing.T) {
+	f := NewFaultInjector(FaultRule{
+		Method:            faultTestMethod,
+		DropAfterMessages: 1,
+	})
+
+	stream := &fakeStream{ctx: context.Background()}
+
+	cs, err := f.StreamClientInterceptor()(context.Background(), &grpc.StreamDesc{ServerStreams: true}, nil, faultTestMethod, func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return &fakeClientStream{fakeStream: stream}, nil
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, cs.SendMsg(nil))
+		require.NoError(t, cs.RecvMsg(nil))
+	}
+
+	assert.Equal(t, 3, stream.sent)
+	assert.Equal(t, 3, stream.recv)
+}
@@ -48,6 +48,8 @@ func (PasswordCredentials) RequireTransportSecurity() bool {
 
 // ---------------------------------------------------------------------
 
+// ConnectionOptions is the original combined client and server configuration.
+// New code should prefer NewGRPCClient/NewGRPCServer with ClientOption/ServerOption values.
 type ConnectionOptions struct {
 	MaxMessageSize int                 // Max message size in bytes
 	SecurityLevel  int                 // 0 = insecure, 1 = secure, 2 = secure with client cert
@@ -60,6 +62,7 @@ type ConnectionOptions struct {
 	MaxRetries     int                 // Max number of retries for transient errors
 	RetryBackoff   time.Duration       // Backoff between retries
 	Credentials    PasswordCredentials // Credentials to pass to downstream middleware (optional)
+	FaultInjector  *FaultInjector      // Inject latency, errors and dropped streams for chaos testing (optional)
 }
 
 // ---------------------------------------------------------------------
@@ -95,13 +98,25 @@ func InitGlobalTracer(serviceName string) (opentracing.Tracer, io.Closer, error)
 	return tracer, closer, nil
 }
 
+// GetGRPCClient creates a client connection to address configured by connectionOptions.
+// connectionOptions is not modified.
 func GetGRPCClient(ctx context.Context, address string, connectionOptions *ConnectionOptions) (*grpc.ClientConn, error) {
-	if address == "" {
-		return nil, errors.New("address is required")
+	return NewGRPCClient(ctx, address, connectionOptions.AsClientOptions()...)
+}
+
+// NewGRPCClient creates a client connection to address configured by opts.
+func NewGRPCClient(ctx context.Context, address string, opts ...ClientOption) (*grpc.ClientConn, error) {
+	clientOptions, err := NewClientOptions(opts...)
+	if err != nil {
+		return nil, err
 	}
 
-	if connectionOptions.MaxMessageSize == 0 {
-		connectionOptions.MaxMessageSize = ONE_GIGABYTE
+	return getGRPCClient(ctx, address, clientOptions)
+}
+
+func getGRPCClient(ctx context.Context, address string, connectionOptions *ClientOptions) (*grpc.ClientConn, error) {
+	if address == "" {
+		return nil, errors.New("address is required")
 	}
 
 	opts := []grpc.DialOption{
@@ -109,10 +124,11 @@ func GetGRPCClient(ctx context.Context, address string, connectionOptions *Conne
 		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig": [{"round_robin":{}}]}`),
 		grpc.WithDefaultCallOptions(
 			grpc.MaxCallSendMsgSize(connectionOptions.MaxMessageSize),
+			grpc.MaxCallRecvMsgSize(connectionOptions.MaxMessageSize),
 		),
 	}
 
-	tlsCredentials, err := loadTLSCredentials(connectionOptions, false)
+	tlsCredentials, err := loadTLSCredentials(&connectionOptions.TLSOptions, false)
 	if err != nil {
 		return nil, err
 	}
@@ -155,13 +171,20 @@ func GetGRPCClient(ctx context.Context, address string, connectionOptions *Conne
 
 	// Retry interceptor...
 	if connectionOptions.MaxRetries > 0 {
-		if connectionOptions.RetryBackoff == 0 {
-			connectionOptions.RetryBackoff = 100 * time.Millisecond
-		}
-
 		opts = append(opts, grpc.WithChainUnaryInterceptor(retryInterceptor(connectionOptions.MaxRetries, connectionOptions.RetryBackoff)))
 	}
 
+	// Fault injection is chained last so that injected failures are seen by the retry interceptor
+	if connectionOptions.FaultInjector != nil {
+		opts = append(
+			opts,
+			grpc.WithChainUnaryInterceptor(connectionOptions.FaultInjector.UnaryClientInterceptor()),
+			grpc.WithChainStreamInterceptor(connectionOptions.FaultInjector.StreamClientInterceptor()),
+		)
+	}
+
+	opts = append(opts, connectionOptions.DialOptions...)
+
 	conn, err := grpc.NewClient(
 		address,
 		opts...,
@@ -173,14 +196,30 @@ func GetGRPCClient(ctx context.Context, address string, connectionOptions *Conne
 	return conn, nil
 }
 
+// GetGRPCServer creates a server configured by connectionOptions.
+// connectionOptions is not modified.
 func GetGRPCServer(connectionOptions *ConnectionOptions) (*grpc.Server, error) {
-	var opts []grpc.ServerOption
+	return NewGRPCServer(connectionOptions.AsServerOptions()...)
+}
 
-	if connectionOptions.MaxMessageSize == 0 {
-		connectionOptions.MaxMessageSize = ONE_GIGABYTE
+// NewGRPCServer creates a server configured by opts.
+func NewGRPCServer(opts ...ServerOption) (*grpc.Server, error) {
+	serverOptions, err := NewServerOptions(opts...)
+	if err != nil {
+		return nil, err
 	}
 
-	opts = append(opts, grpc.MaxRecvMsgSize(connectionOptions.MaxMessageSize))
+	return getGRPCServer(serverOptions)
+}
+
+func getGRPCServer(connectionOptions *ServerOptions) (*grpc.Server, error) {
+	var opts []grpc.ServerOption
+
+	opts = append(
+		opts,
+		grpc.MaxRecvMsgSize(connectionOptions.MaxMessageSize),
+		grpc.MaxSendMsgSize(connectionOptions.MaxMessageSize),
+	)
 
 	if connectionOptions.OpenTelemetry {
 		opts = append(
@@ -208,13 +247,23 @@ func GetGRPCServer(connectionOptions *ConnectionOptions) (*grpc.Server, error) {
 		)
 	}
 
-	tlsCredentials, err := loadTLSCredentials(connectionOptions, true)
+	if connectionOptions.FaultInjector != nil {
+		opts = append(
+			opts,
+			grpc.ChainUnaryInterceptor(connectionOptions.FaultInjector.UnaryServerInterceptor()),
+			grpc.ChainStreamInterceptor(connectionOptions.FaultInjector.StreamServerInterceptor()),
+		)
+	}
+
+	tlsCredentials, err := loadTLSCredentials(&connectionOptions.TLSOptions, true)
 	if err != nil {
 		return nil, err
 	}
 
 	opts = append(opts, grpc.Creds(tlsCredentials))
 
+	opts = append(opts, connectionOptions.RawServerOptions...)
+
 	return grpc.NewServer(opts...), nil
 }
 
@@ -248,7 +297,7 @@ func retryInterceptor(maxRetries int, retryBackoff time.Duration) grpc.UnaryClie
 	}
 }
 
-func loadTLSCredentials(connectionData *ConnectionOptions, isServer bool) (credentials.TransportCredentials, error) {
+func loadTLSCredentials(connectionData *TLSOptions, isServer bool) (credentials.TransportCredentials, error) {
 	switch connectionData.SecurityLevel {
 	case 0:
 		// No security
@@ -0,0 +1,317 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+const defaultRetryBackoff = 100 * time.Millisecond
+
+// TLSOptions holds the transport security settings for a client or a server.
+//
+// The meaning of SecurityLevel differs per side:
+//
+//	0 = insecure on both sides
+//	1 = server presents CertFile/KeyFile; client verifies it with CaCertFile
+//	2 = as 1, and the server requires any client cert which the client presents from CertFile/KeyFile
+//	3 = as 2, and the server verifies the client cert with CaCertFile
+type TLSOptions struct {
+	SecurityLevel int    // 0, 1, 2 or 3 (see above)
+	CertFile      string // Cert file if SecurityLevel > 0 (server) or > 1 (client)
+	CaCertFile    string // CA cert file if SecurityLevel > 0 (client) or > 2 (server)
+	KeyFile       string // Key file for CertFile
+}
+
+// CommonOptions holds the settings that apply to both clients and servers.
+type CommonOptions struct {
+	TLSOptions
+	MaxMessageSize int            // Max message size in bytes, defaults to ONE_GIGABYTE
+	OpenTelemetry  bool           // Enable OpenTelemetry tracing
+	OpenTracing    bool           // Enable OpenTracing tracing
+	Prometheus     bool           // Enable Prometheus metrics
+	FaultInjector  *FaultInjector // Inject latency, errors and dropped streams for chaos testing (optional)
+}
+
+// ClientOptions holds the settings used by NewGRPCClient.
+// Use NewClientOptions to create a validated instance with defaults applied.
+type ClientOptions struct {
+	CommonOptions
+	MaxRetries   int                 // Max number of retries for transient errors
+	RetryBackoff time.Duration       // Backoff between retries, defaults to 100ms
+	Credentials  PasswordCredentials // Credentials to pass to downstream middleware (optional)
+	DialOptions  []grpc.DialOption   // Raw dial options appended after all others
+}
+
+// ServerOptions holds the settings used by NewGRPCServer.
+// Use NewServerOptions to create a validated instance with defaults applied.
+type ServerOptions struct {
+	CommonOptions
+	RawServerOptions []grpc.ServerOption // Raw server options appended after all others
+}
+
+// ClientOption configures ClientOptions.
+type ClientOption interface {
+	applyClient(o *ClientOptions)
+}
+
+// ServerOption configures ServerOptions.
+type ServerOption interface {
+	applyServer(o *ServerOptions)
+}
+
+// GRPCOption configures settings that are common to clients and servers,
+// and can be used as both a ClientOption and a ServerOption.
+type GRPCOption func(o *CommonOptions)
+
+func (f GRPCOption) applyClient(o *ClientOptions) { f(&o.CommonOptions) }
+func (f GRPCOption) applyServer(o *ServerOptions) { f(&o.CommonOptions) }
+
+type clientOption func(o *ClientOptions)
+
+func (f clientOption) applyClient(o *ClientOptions) { f(o) }
+
+type serverOption func(o *ServerOptions)
+
+func (f serverOption) applyServer(o *ServerOptions) { f(o) }
+
+// WithMaxMessageSize sets the maximum size in bytes of messages sent and received.
+func WithMaxMessageSize(size int) GRPCOption {
+	return func(o *CommonOptions) {
+		o.MaxMessageSize = size
+	}
+}
+
+// WithSecurityLevel sets the security level (see TLSOptions).
+func WithSecurityLevel(level int) GRPCOption {
+	return func(o *CommonOptions) {
+		o.SecurityLevel = level
+	}
+}
+
+// WithCertFile sets the cert and key files presented to the other side.
+func WithCertFile(certFile string, keyFile string) GRPCOption {
+	return func(o *CommonOptions) {
+		o.CertFile = certFile
+		o.KeyFile = keyFile
+	}
+}
+
+// WithCaCertFile sets the CA cert file used to verify the other side.
+func WithCaCertFile(caCertFile string) GRPCOption {
+	return func(o *CommonOptions) {
+		o.CaCertFile = caCertFile
+	}
+}
+
+// WithOpenTelemetry enables OpenTelemetry tracing.
+func WithOpenTelemetry() GRPCOption {
+	return func(o *CommonOptions) {
+		o.OpenTelemetry = true
+	}
+}
+
+// WithOpenTracing enables OpenTracing tracing using the global tracer.
+func WithOpenTracing() GRPCOption {
+	return func(o *CommonOptions) {
+		o.OpenTracing = true
+	}
+}
+
+// WithPrometheus enables Prometheus metrics.
+func WithPrometheus() GRPCOption {
+	return func(o *CommonOptions) {
+		o.Prometheus = true
+	}
+}
+
+// WithFaultInjector injects faults using f.
+func WithFaultInjector(f *FaultInjector) GRPCOption {
+	return func(o *CommonOptions) {
+		o.FaultInjector = f
+	}
+}
+
+// WithRetries retries unary calls that fail with a transient error up to maxRetries times,
+// waiting backoff between attempts. A backoff of 0 uses the default of 100ms.
+func WithRetries(maxRetries int, backoff time.Duration) ClientOption {
+	return clientOption(func(o *ClientOptions) {
+		o.MaxRetries = maxRetries
+		o.RetryBackoff = backoff
+	})
+}
+
+// WithCredentials passes credentials to downstream middleware on every call.
+func WithCredentials(credentials PasswordCredentials) ClientOption {
+	return clientOption(func(o *ClientOptions) {
+		o.Credentials = credentials
+	})
+}
+
+// WithDialOptions appends raw grpc.DialOption values.
+func WithDialOptions(opts ...grpc.DialOption) ClientOption {
+	return clientOption(func(o *ClientOptions) {
+		o.DialOptions = append(o.DialOptions, opts...)
+	})
+}
+
+// WithServerOptions appends raw grpc.ServerOption values.
+func WithServerOptions(opts ...grpc.ServerOption) ServerOption {
+	return serverOption(func(o *ServerOptions) {
+		o.RawServerOptions = append(o.RawServerOptions, opts...)
+	})
+}
+
+// NewClientOptions applies opts, fills in defaults and validates the result.
+func NewClientOptions(opts ...ClientOption) (*ClientOptions, error) {
+	o := &ClientOptions{}
+
+	for _, opt := range opts {
+		opt.applyClient(o)
+	}
+
+	if o.MaxMessageSize == 0 {
+		o.MaxMessageSize = ONE_GIGABYTE
+	}
+
+	if o.MaxRetries > 0 && o.RetryBackoff == 0 {
+		o.RetryBackoff = defaultRetryBackoff
+	}
+
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// NewServerOptions applies opts, fills in defaults and validates the result.
+func NewServerOptions(opts ...ServerOption) (*ServerOptions, error) {
+	o := &ServerOptions{}
+
+	for _, opt := range opts {
+		opt.applyServer(o)
+	}
+
+	if o.MaxMessageSize == 0 {
+		o.MaxMessageSize = ONE_GIGABYTE
+	}
+
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// Validate checks that the options are consistent.
+func (o *ClientOptions) Validate() error {
+	if err := o.CommonOptions.validate(); err != nil {
+		return err
+	}
+
+	if o.MaxRetries < 0 {
+		return errors.New("maxRetries must not be negative")
+	}
+
+	if o.RetryBackoff < 0 {
+		return errors.New("retryBackoff must not be negative")
+	}
+
+	if o.SecurityLevel > 0 && o.CaCertFile == "" {
+		return fmt.Errorf("caCertFile is required for securityLevel %d", o.SecurityLevel)
+	}
+
+	if o.SecurityLevel > 1 && (o.CertFile == "" || o.KeyFile == "") {
+		return fmt.Errorf("certFile and keyFile are required for securityLevel %d", o.SecurityLevel)
+	}
+
+	return nil
+}
+
+// Validate checks that the options are consistent.
+func (o *ServerOptions) Validate() error {
+	if err := o.CommonOptions.validate(); err != nil {
+		return err
+	}
+
+	if o.SecurityLevel > 0 && (o.CertFile == "" || o.KeyFile == "") {
+		return fmt.Errorf("certFile and keyFile are required for securityLevel %d", o.SecurityLevel)
+	}
+
+	if o.SecurityLevel > 2 && o.CaCertFile == "" {
+		return fmt.Errorf("caCertFile is required for securityLevel %d", o.SecurityLevel)
+	}
+
+	return nil
+}
+
+func (o *CommonOptions) validate() error {
+	if o.SecurityLevel < 0 || o.SecurityLevel > 3 {
+		return errors.New("securityLevel must be 0, 1, 2 or 3")
+	}
+
+	if o.MaxMessageSize < 0 {
+		return errors.New("maxMessageSize must not be negative")
+	}
+
+	return nil
+}
+
+// ---------------------------------------------------------------------
+// ConnectionOptions is kept as a compatibility adapter for the options above.
+
+func (o *ConnectionOptions) commonOptions() []GRPCOption {
+	opts := []GRPCOption{
+		WithMaxMessageSize(o.MaxMessageSize),
+		WithSecurityLevel(o.SecurityLevel),
+		WithCertFile(o.CertFile, o.KeyFile),
+		WithCaCertFile(o.CaCertFile),
+		WithFaultInjector(o.FaultInjector),
+	}
+
+	if o.OpenTelemetry {
+		opts = append(opts, WithOpenTelemetry())
+	}
+
+	if o.OpenTracing {
+		opts = append(opts, WithOpenTracing())
+	}
+
+	if o.Prometheus {
+		opts = append(opts, WithPrometheus())
+	}
+
+	return opts
+}
+
+// AsClientOptions returns the ConnectionOptions as a list of ClientOption.
+func (o *ConnectionOptions) AsClientOptions() []ClientOption {
+	var opts []ClientOption
+
+	for _, opt := range o.commonOptions() {
+		opts = append(opts, opt)
+	}
+
+	opts = append(opts, WithRetries(o.MaxRetries, o.RetryBackoff))
+
+	if o.Credentials != nil {
+		opts = append(opts, WithCredentials(o.Credentials))
+	}
+
+	return opts
+}
+
+// AsServerOptions returns the ConnectionOptions as a list of ServerOption.
+// Client only settings are ignored.
+func (o *ConnectionOptions) AsServerOptions() []ServerOption {
+	var opts []ServerOption
+
+	for _, opt := range o.commonOptions() {
+		opts = append(opts, opt)
+	}
+
+	return opts
+}
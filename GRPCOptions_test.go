@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestNewClientOptionsDefaults(t *testing.T) {
+	o, err := NewClientOptions(WithRetries(3, 0), WithOpenTelemetry())
+	require.NoError(t, err)
+
+	assert.Equal(t, ONE_GIGABYTE, o.MaxMessageSize)
+	assert.Equal(t, 3, o.MaxRetries)
+	assert.Equal(t, 100*time.Millisecond, o.RetryBackoff)
+	assert.True(t, o.OpenTelemetry)
+}
+
+func TestNewClientOptionsValidation(t *testing.T) {
+	_, err := NewClientOptions(WithSecurityLevel(4))
+	assert.Error(t, err)
+
+	_, err = NewClientOptions(WithSecurityLevel(1))
+	assert.Error(t, err)
+
+	_, err = NewClientOptions(WithSecurityLevel(2), WithCaCertFile("ca.crt"))
+	assert.Error(t, err)
+
+	_, err = NewClientOptions(WithRetries(-1, 0))
+	assert.Error(t, err)
+
+	_, err = NewClientOptions(WithSecurityLevel(2), WithCaCertFile("ca.crt"), WithCertFile("client.crt", "client.key"))
+	assert.NoError(t, err)
+}
+
+func TestNewServerOptionsValidation(t *testing.T) {
+	_, err := NewServerOptions(WithSecurityLevel(1))
+	assert.Error(t, err)
+
+	_, err = NewServerOptions(WithSecurityLevel(3), WithCertFile("server.crt", "server.key"))
+	assert.Error(t, err)
+
+	o, err := NewServerOptions(WithMaxMessageSize(1024), WithServerOptions(grpc.MaxConcurrentStreams(10)))
+	require.NoError(t, err)
+
+	assert.Equal(t, 1024, o.MaxMessageSize)
+	assert.Len(t, o.RawServerOptions, 1)
+}
+
+func TestConnectionOptionsNotMutated(t *testing.T) {
+	connectionOptions := &ConnectionOptions{
+		MaxRetries: 3,
+	}
+
+	conn, err := GetGRPCClient(context.Background(), "localhost:9999", connectionOptions)
+	require.NoError(t, err)
+	_ = conn.Close()
+
+	srv, err := GetGRPCServer(connectionOptions)
+	require.NoError(t, err)
+	srv.Stop()
+
+	assert.Equal(t, ConnectionOptions{MaxRetries: 3}, *connectionOptions)
+}
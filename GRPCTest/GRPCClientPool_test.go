@@ -0,0 +1,159 @@
+package greeter
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ordishs/go-utils"
+	greeter_api "github.com/ordishs/go-utils/GRPCTest/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+func TestClientPool(t *testing.T) {
+	srv, err := utils.NewGRPCServer()
+	require.NoError(t, err)
+
+	greeter_api.RegisterGreeterServiceServer(srv, &GreeterService{})
+
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	defer srv.Stop()
+
+	var mu sync.Mutex
+	var states []connectivity.State
+
+	pool := utils.NewClientPool(50 * time.Millisecond).WithStateChangeFunction(func(address string, state connectivity.State) {
+		mu.Lock()
+		defer mu.Unlock()
+		states = append(states, state)
+	})
+	defer pool.Close()
+
+	conn1, err := pool.Get(context.Background(), lis.Addr().String())
+	require.NoError(t, err)
+
+	conn2, err := pool.Get(context.Background(), lis.Addr().String())
+	require.NoError(t, err)
+
+	assert.Same(t, conn1, conn2)
+	assert.Equal(t, 1, pool.Len())
+
+	// A different key gets a different connection
+	conn3, err := pool.GetWithKey(context.Background(), lis.Addr().String(), "retries", utils.WithRetries(3, 0))
+	require.NoError(t, err)
+	assert.NotSame(t, conn1, conn3)
+	assert.Equal(t, 2, pool.Len())
+
+	require.NoError(t, pool.WaitForReady(context.Background(), conn1, time.Second))
+
+	res, err := greeter_api.NewGreeterServiceClient(conn1).SayHello(context.Background(), &greeter_api.HelloRequest{Name: "World"})
+	require.NoError(t, err)
+	assert.Equal(t, "Hello, World", res.Message)
+
+	pool.Release(conn1)
+	pool.Release(conn3)
+
+	// conn3 is closed once it has been idle for the TTL, but conn1 still has a reference and must survive it
+	assert.Eventually(t, func() bool {
+		return conn3.GetState() == connectivity.Shutdown
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, pool.Len())
+
+	pool.Release(conn2)
+
+	assert.Eventually(t, func() bool {
+		return pool.Len() == 0
+	}, time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	assert.Contains(t, states, connectivity.Ready)
+	mu.Unlock()
+}
+
+func TestClientPoolKeys(t *testing.T) {
+	pool := utils.NewClientPool(0)
+	defer pool.Close()
+
+	const address = "localhost:1"
+
+	var wg sync.WaitGroup
+
+	conns := make([]*grpc.ClientConn, 10)
+
+	for i := range conns {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			conn, err := pool.GetWithKey(context.Background(), address, "a", utils.WithRetries(3, 0))
+			assert.NoError(t, err)
+
+			conns[i] = conn
+		}()
+	}
+
+	wg.Wait()
+
+	// Concurrent callers with the same key share one connection
+	for _, conn := range conns {
+		assert.Same(t, conns[0], conn)
+	}
+
+	plain, err := pool.Get(context.Background(), address)
+	require.NoError(t, err)
+	assert.NotSame(t, conns[0], plain)
+
+	other, err := pool.GetWithKey(context.Background(), address, "b")
+	require.NoError(t, err)
+	assert.NotSame(t, conns[0], other)
+	assert.NotSame(t, plain, other)
+
+	assert.Equal(t, 3, pool.Len())
+
+	_, err = pool.GetWithKey(context.Background(), address, "")
+	assert.Error(t, err)
+
+	// The same key with different options is an error rather than a shared connection
+	_, err = pool.GetWithKey(context.Background(), address, "a", utils.WithRetries(5, 0))
+	assert.ErrorContains(t, err, "different options")
+
+	dialOption := grpc.WithUserAgent("test")
+
+	withDialOption, err := pool.GetWithKey(context.Background(), address, "c", utils.WithDialOptions(dialOption))
+	require.NoError(t, err)
+
+	same, err := pool.GetWithKey(context.Background(), address, "c", utils.WithDialOptions(dialOption))
+	require.NoError(t, err)
+	assert.Same(t, withDialOption, same)
+
+	require.NoError(t, pool.Close())
+
+	_, err = pool.Get(context.Background(), address)
+	assert.Error(t, err)
+}
+
+func TestWaitForReadyTimeout(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+
+	address := lis.Addr().String()
+	_ = lis.Close()
+
+	conn, err := utils.NewGRPCClient(context.Background(), address)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	err = utils.WaitForReady(context.Background(), conn, 100*time.Millisecond)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -2,7 +2,10 @@ package greeter
 
 import (
 	"context"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"net"
 
@@ -11,7 +14,10 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
 )
 
 type GreeterService struct {
@@ -217,3 +223,194 @@ func TestGRPCServerUsingGRPCHelperSecurityLevel3(t *testing.T) {
 
 	assert.Equal(t, "Hello, World", res.Message)
 }
+
+func TestGRPCServerUsingBufconnHarness(t *testing.T) {
+	h, err := utils.NewBufconnHarness(context.Background(), &utils.ConnectionOptions{
+		OpenTelemetry: true,
+	}, &utils.ConnectionOptions{
+		OpenTelemetry: true,
+		MaxRetries:    10,
+	}, func(srv *grpc.Server) {
+		greeter_api.RegisterGreeterServiceServer(srv, &GreeterService{})
+	})
+	require.NoError(t, err)
+
+	defer func() {
+		assert.NoError(t, h.Close())
+	}()
+
+	client := greeter_api.NewGreeterServiceClient(h.Conn)
+
+	// Send a simple request to the server
+	req := &greeter_api.HelloRequest{Name: "World"}
+	res, err := client.SayHello(context.Background(), req)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Hello, World", res.Message)
+
+	// Close can be called again, e.g. by a deferred cleanup
+	require.NoError(t, h.Close())
+}
+
+func TestGRPCServerUsingBufconnHarnessSecurityLevel3(t *testing.T) {
+	h, err := utils.NewBufconnHarness(context.Background(), &utils.ConnectionOptions{
+		SecurityLevel: 3,
+		CertFile:      "certs/server.crt",
+		KeyFile:       "certs/server.key",
+		CaCertFile:    "certs/ca.crt",
+	}, &utils.ConnectionOptions{
+		SecurityLevel: 3,
+		CertFile:      "certs/client1.crt",
+		KeyFile:       "certs/client1.key",
+		CaCertFile:    "certs/ca.crt",
+	}, func(srv *grpc.Server) {
+		greeter_api.RegisterGreeterServiceServer(srv, &GreeterService{})
+	})
+	require.NoError(t, err)
+
+	defer func() {
+		assert.NoError(t, h.Close())
+	}()
+
+	client := greeter_api.NewGreeterServiceClient(h.Conn)
+
+	req := &greeter_api.HelloRequest{Name: "World"}
+	res, err := client.SayHello(context.Background(), req)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Hello, World", res.Message)
+}
+
+func TestGRPCServerWithFaultInjector(t *testing.T) {
+	faultInjector := utils.NewFaultInjector(utils.FaultRule{
+		Method:           greeter_api.GreeterService_SayHello_FullMethodName,
+		ErrorCode:        codes.ResourceExhausted,
+		ErrorProbability: 1,
+	})
+
+	h, err := utils.NewBufconnHarness(context.Background(), &utils.ConnectionOptions{
+		FaultInjector: faultInjector,
+	}, &utils.ConnectionOptions{}, func(srv *grpc.Server) {
+		greeter_api.RegisterGreeterServiceServer(srv, &GreeterService{})
+	})
+	require.NoError(t, err)
+
+	defer func() {
+		assert.NoError(t, h.Close())
+	}()
+
+	client := greeter_api.NewGreeterServiceClient(h.Conn)
+
+	req := &greeter_api.HelloRequest{Name: "World"}
+	_, err = client.SayHello(context.Background(), req)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// Change the rule at runtime to only add latency
+	faultInjector.SetRule(utils.FaultRule{
+		Method:  greeter_api.GreeterService_SayHello_FullMethodName,
+		Latency: 50 * time.Millisecond,
+	})
+
+	start := time.Now()
+	res, err := client.SayHello(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello, World", res.Message)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	faultInjector.Clear()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = client.SayHello(ctx, req)
+	require.NoError(t, err)
+}
+
+// countingGreeterService counts the calls that reach the handler.
+type countingGreeterService struct {
+	GreeterService
+	calls atomic.Int32
+}
+
+func (s *countingGreeterService) SayHello(ctx context.Context, req *greeter_api.HelloRequest) (*greeter_api.HelloResponse, error) {
+	s.calls.Add(1)
+	return s.GreeterService.SayHello(ctx, req)
+}
+
+func TestGRPCClientRetriesInjectedFaults(t *testing.T) {
+	faultInjector := utils.NewFaultInjector(utils.FaultRule{
+		ErrorProbability: 1,
+	})
+
+	// grpc.UnaryInterceptor runs before the chained interceptors, so it sees every
+	// attempt, including those that fail in the fault injector.
+	var attempts atomic.Int32
+
+	srv, err := utils.NewGRPCServer(
+		utils.WithFaultInjector(faultInjector),
+		utils.WithServerOptions(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			attempts.Add(1)
+			return handler(ctx, req)
+		})),
+	)
+	require.NoError(t, err)
+
+	service := &countingGreeterService{}
+	greeter_api.RegisterGreeterServiceServer(srv, service)
+
+	lis := bufconn.Listen(1024 * 1024)
+
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	defer srv.Stop()
+
+	conn, err := utils.NewGRPCClient(context.Background(), "passthrough:///bufconn",
+		utils.WithRetries(3, time.Millisecond),
+		utils.WithDialOptions(grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		})),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	client := greeter_api.NewGreeterServiceClient(conn)
+
+	_, err = client.SayHello(context.Background(), &greeter_api.HelloRequest{Name: "World"})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	// The retry interceptor makes MaxRetries attempts in total, and all of them fail
+	// before reaching the handler
+	assert.Equal(t, int32(3), attempts.Load())
+	assert.Equal(t, int32(0), service.calls.Load())
+
+	faultInjector.Clear()
+
+	res, err := client.SayHello(context.Background(), &greeter_api.HelloRequest{Name: "World"})
+	require.NoError(t, err)
+	assert.Equal(t, "Hello, World", res.Message)
+
+	assert.Equal(t, int32(4), attempts.Load())
+	assert.Equal(t, int32(1), service.calls.Load())
+}
+
+func TestGRPCLargeMessagesUsingBufconnHarness(t *testing.T) {
+	h, err := utils.NewBufconnHarness(context.Background(), &utils.ConnectionOptions{}, &utils.ConnectionOptions{}, func(srv *grpc.Server) {
+		greeter_api.RegisterGreeterServiceServer(srv, &GreeterService{})
+	})
+	require.NoError(t, err)
+
+	defer func() {
+		assert.NoError(t, h.Close())
+	}()
+
+	client := greeter_api.NewGreeterServiceClient(h.Conn)
+
+	// Both the request and the response exceed gRPC's default limit of 4 MB
+	name := strings.Repeat("x", 5*1024*1024)
+
+	res, err := client.SayHello(context.Background(), &greeter_api.HelloRequest{Name: name})
+	require.NoError(t, err)
+
+	assert.Equal(t, len(name)+len("Hello, "), len(res.Message))
+}
@@ -1,6 +1,12 @@
 package utils
 
-import "log"
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+)
 
 type Logger interface {
 	LogLevel() int
@@ -36,3 +42,75 @@ func (l *defaultLogger) Errorf(format string, args ...interface{}) {
 func (l *defaultLogger) Fatalf(format string, args ...interface{}) {
 	println("FATAL: "+format, args)
 }
+
+// NopLogger is a Logger that discards all messages. It is useful in tests.
+type NopLogger struct{}
+
+// LogLevel returns the most restrictive gocore level (5 = panic), as nothing is logged.
+func (NopLogger) LogLevel() int {
+	return 5
+}
+
+func (NopLogger) Debugf(format string, args ...interface{}) {}
+
+func (NopLogger) Infof(format string, args ...interface{}) {}
+
+func (NopLogger) Warnf(format string, args ...interface{}) {}
+
+func (NopLogger) Errorf(format string, args ...interface{}) {}
+
+func (NopLogger) Fatalf(format string, args ...interface{}) {}
+
+// SlogLogger adapts a *slog.Logger to the Logger interface.
+type SlogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger returns a Logger that writes to logger.
+// If logger is nil, slog.Default() is used.
+func NewSlogLogger(logger *slog.Logger) *SlogLogger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &SlogLogger{logger: logger}
+}
+
+// LogLevel returns the lowest enabled level using the same numbering as gocore:
+// 0 = debug, 1 = info, 2 = warn, 3 = error.
+func (l *SlogLogger) LogLevel() int {
+	ctx := context.Background()
+
+	switch {
+	case l.logger.Enabled(ctx, slog.LevelDebug):
+		return 0
+	case l.logger.Enabled(ctx, slog.LevelInfo):
+		return 1
+	case l.logger.Enabled(ctx, slog.LevelWarn):
+		return 2
+	default:
+		return 3
+	}
+}
+
+func (l *SlogLogger) Debugf(format string, args ...interface{}) {
+	l.logger.Debug(fmt.Sprintf(format, args...))
+}
+
+func (l *SlogLogger) Infof(format string, args ...interface{}) {
+	l.logger.Info(fmt.Sprintf(format, args...))
+}
+
+func (l *SlogLogger) Warnf(format string, args ...interface{}) {
+	l.logger.Warn(fmt.Sprintf(format, args...))
+}
+
+func (l *SlogLogger) Errorf(format string, args ...interface{}) {
+	l.logger.Error(fmt.Sprintf(format, args...))
+}
+
+// Fatalf logs the message at error level and exits the process.
+func (l *SlogLogger) Fatalf(format string, args ...interface{}) {
+	l.logger.Error(fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
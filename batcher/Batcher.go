@@ -1,30 +1,247 @@
 package batcher
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/ordishs/go-utils/stat"
+)
+
+var (
+	// ErrClosed is returned when an item is put after Close has been called.
+	ErrClosed = errors.New("batcher: closed")
+	// ErrDropped is returned by PutCtx when the item was discarded by the DropNewest overflow policy.
+	ErrDropped = errors.New("batcher: buffer full, item dropped")
 )
 
+// OverflowPolicy decides what happens to an item that is put while the input buffer is full.
+type OverflowPolicy int
+
+const (
+	Block      OverflowPolicy = iota // Wait until there is room in the buffer (default)
+	DropNewest                       // Discard the item being put
+	DropOldest                       // Discard the oldest item in the buffer to make room, or the item being put if there is no buffer
+)
+
+type options[T any] struct {
+	bufferSize int
+	overflow   OverflowPolicy
+	maxRetries int
+	backoff    time.Duration
+	split      bool
+	deadLetter func(items []*T, err error)
+	maxBatches int
+	orderKey   func(item *T) string
+	maxWeight  int
+	weight     func(item *T) int
+}
+
+// Option configures a Batcher of items of type T.
+type Option[T any] func(o *options[T])
+
+// WithBufferSize sets the number of items that can be put while the batch function
+// is running before producers are blocked or items are dropped. The default is 0.
+func WithBufferSize[T any](size int) Option[T] {
+	return func(o *options[T]) {
+		o.bufferSize = size
+	}
+}
+
+// WithOverflowPolicy sets what Put and PutCtx do when the buffer is full. The default is Block.
+func WithOverflowPolicy[T any](policy OverflowPolicy) Option[T] {
+	return func(o *options[T]) {
+		o.overflow = policy
+	}
+}
+
+// WithRetries retries a batch that fails up to maxRetries times. The delay before the
+// first retry is backoff, and doubles with every retry. It only applies to batchers
+// created with NewWithError.
+func WithRetries[T any](maxRetries int, backoff time.Duration) Option[T] {
+	return func(o *options[T]) {
+		o.maxRetries = maxRetries
+		o.backoff = backoff
+	}
+}
+
+// WithSplitting splits a batch that still fails after all retries into two halves
+// that are processed separately, recursively, so that a poison item only causes
+// itself to fail. Every half is retried according to WithRetries.
+func WithSplitting[T any]() Option[T] {
+	return func(o *options[T]) {
+		o.split = true
+	}
+}
+
+// WithDeadLetter calls fn with the items that ultimately failed and the last error.
+// Without it, failed items are only counted in Stats. To receive failed items on a
+// channel, send them from fn. A panic in the batch function is passed to fn as an
+// error that includes the stack; without a dead-letter function the panic is not
+// recovered.
+func WithDeadLetter[T any](fn func(items []*T, err error)) Option[T] {
+	return func(o *options[T]) {
+		o.deadLetter = fn
+	}
+}
+
+// WithMaxConcurrentBatches limits the number of batches processed at the same time in
+// the background. When the limit is reached, the Batcher stops taking items from the
+// buffer until a batch completes, which applies backpressure to Put according to the
+// overflow policy. The default of 0 means no limit.
+func WithMaxConcurrentBatches[T any](n int) Option[T] {
+	return func(o *options[T]) {
+		o.maxBatches = n
+	}
+}
+
+// WithOrderingKey splits every batch by the key of its items, and processes the
+// batches of the same key one after the other, in the order they were formed.
+// Batches with different keys are processed concurrently in the background.
+func WithOrderingKey[T any](fn func(item *T) string) Option[T] {
+	return func(o *options[T]) {
+		o.orderKey = fn
+	}
+}
+
+// WithMaxWeight closes a batch when the total weight of its items, as returned by
+// weight (for example their size in bytes), reaches maxWeight, in addition to the
+// item count and the timeout. An item that would take a batch over maxWeight starts
+// the next batch, so an item heavier than maxWeight is processed alone.
+func WithMaxWeight[T any](maxWeight int, weight func(item *T) int) Option[T] {
+	return func(o *options[T]) {
+		o.maxWeight = maxWeight
+		o.weight = weight
+	}
+}
+
+// Stats holds the counters of a Batcher.
+type Stats struct {
+	Accepted uint64 // Items added to the buffer
+	Dropped  uint64 // Items discarded by the overflow policy
+	Evicted  uint64 // Accepted items discarded by DropOldest to make room, also counted in Dropped
+	Rejected uint64 // Items refused by TryPut because the buffer was full
+	Buffered int    // Items waiting in the buffer
+	Retries  uint64 // Retried calls to the batch function
+	Failed   uint64 // Items that failed after all retries
+
+	InFlight    int64 // Batches being processed
+	MaxInFlight int64 // Highest number of batches processed at the same time
+}
+
 // Batcher is a utility that batches items together and then invokes the provided function
 // on that whenever it reaches the specified size or the timeout is reached.
+//
+// A Batcher implements servicemanager.Service so that pending items are processed when
+// the ServiceManager shuts down: Start waits until the ServiceManager stops, and Stop
+// calls Close.
 type Batcher[T any] struct {
-	fn         func([]*T)
-	size       int
-	timeout    time.Duration
-	batch      []*T
-	ch         chan *T
-	background bool
+	fn          func(ctx context.Context, batch []*T) error
+	size        int
+	timeout     time.Duration
+	batch       []*T
+	ch          chan *T
+	background  bool
+	overflow    OverflowPolicy
+	maxRetries  int
+	backoff     time.Duration
+	split       bool
+	deadLetter  func(items []*T, err error)
+	orderKey    func(item *T) string
+	maxWeight   int
+	weight      func(item *T) int
+	batchWeight int
+	weights     []int         // Weights of the items in batch, so that weight is called once per item
+	carry       *T            // Item that did not fit in the previous batch because of its weight
+	carryWeight int           // Weight of carry
+	sem         chan struct{} // Limits the number of concurrent background batches
+	inFlight    *stat.Gauge
+	tailsMu     sync.Mutex
+	tails       map[string]chan struct{} // Closed when the last batch of a key has been processed
+
+	// ctx is passed to the batch function and is cancelled when Close gives up
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	accepted atomic.Uint64
+	dropped  atomic.Uint64
+	evicted  atomic.Uint64
+	rejected atomic.Uint64
+	retries  atomic.Uint64
+	failed   atomic.Uint64
+
+	flushCh   chan chan struct{}
+	mu        sync.RWMutex
+	closed    bool
+	closing   chan struct{} // Closed when Close is called, to release blocked producers
+	closeOnce sync.Once
+	done      chan struct{} // Closed when the worker has processed the last batch
+	wg        sync.WaitGroup
 }
 
 // New creates a new Batcher that will invoke the provided function when the batch size is reached.
 // The size is the maximum number of items that can be batched before processing the batch.
 // The timeout is the duration that will be waited before processing the batch.
-func New[T any](size int, timeout time.Duration, fn func(batch []*T), background bool) *Batcher[T] {
+func New[T any](size int, timeout time.Duration, fn func(batch []*T), background bool, opts ...Option[T]) *Batcher[T] {
+	return NewWithError(size, timeout, func(_ context.Context, batch []*T) error {
+		fn(batch)
+		return nil
+	}, background, opts...)
+}
+
+// NewWithError is like New for batch functions that can fail. A failed batch is
+// retried according to WithRetries, optionally split with WithSplitting, and the
+// items that ultimately fail are passed to the WithDeadLetter function.
+// The context passed to fn is cancelled if Close gives up waiting for the batches.
+func NewWithError[T any](size int, timeout time.Duration, fn func(ctx context.Context, batch []*T) error, background bool, opts ...Option[T]) *Batcher[T] {
+	o := options[T]{}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.bufferSize < 0 {
+		o.bufferSize = 0
+	}
+
+	if o.maxWeight <= 0 {
+		o.weight = nil
+	}
+
+	var sem chan struct{}
+
+	if o.maxBatches > 0 {
+		sem = make(chan struct{}, o.maxBatches)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
 	b := &Batcher[T]{
 		fn:         fn,
 		size:       size,
 		timeout:    timeout,
-		ch:         make(chan *T),
+		ch:         make(chan *T, o.bufferSize),
 		background: background,
+		overflow:   o.overflow,
+		maxRetries: o.maxRetries,
+		backoff:    o.backoff,
+		split:      o.split,
+		deadLetter: o.deadLetter,
+		orderKey:   o.orderKey,
+		maxWeight:  o.maxWeight,
+		weight:     o.weight,
+		sem:        sem,
+		inFlight:   stat.NewGauge(),
+		tails:      make(map[string]chan struct{}),
+		ctx:        ctx,
+		cancel:     cancel,
+		flushCh:    make(chan chan struct{}),
+		closing:    make(chan struct{}),
+		done:       make(chan struct{}),
 	}
 
 	go b.worker()
@@ -33,40 +250,460 @@ func New[T any](size int, timeout time.Duration, fn func(batch []*T), background
 }
 
 // Put adds an item to the batch. If the batch is full, or the timeout is reached
-// the batch will be processed.
+// the batch will be processed. When the buffer is full, Put blocks or drops an item
+// according to the overflow policy. Items put after Close has been called are discarded.
 func (b *Batcher[T]) Put(item *T) {
-	b.ch <- item
+	_ = b.PutCtx(context.Background(), item)
+}
+
+// PutCtx is like Put but returns ctx.Err() if ctx is done while waiting for room in
+// the buffer, ErrClosed if the Batcher has been closed, and ErrDropped if the item was
+// discarded by the DropNewest overflow policy.
+func (b *Batcher[T]) PutCtx(ctx context.Context, item *T) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+
+	if b.trySend(item) {
+		return nil
+	}
+
+	overflow := b.overflow
+	if overflow == DropOldest && cap(b.ch) == 0 {
+		// There is no buffer to drop from
+		overflow = DropNewest
+	}
+
+	switch overflow {
+	case DropNewest:
+		b.dropped.Add(1)
+		return ErrDropped
+
+	case DropOldest:
+		for {
+			select {
+			case <-b.ch:
+				b.dropped.Add(1)
+				b.evicted.Add(1)
+			default:
+			}
+
+			if b.trySend(item) {
+				return nil
+			}
+		}
+	}
+
+	select {
+	case b.ch <- item:
+		b.accepted.Add(1)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-b.closing:
+		return ErrClosed
+	}
+}
+
+// TryPut adds an item without blocking. It returns false if the buffer is full or
+// the Batcher has been closed, regardless of the overflow policy.
+func (b *Batcher[T]) TryPut(item *T) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return false
+	}
+
+	if b.trySend(item) {
+		return true
+	}
+
+	b.rejected.Add(1)
+
+	return false
+}
+
+func (b *Batcher[T]) trySend(item *T) bool {
+	select {
+	case b.ch <- item:
+		b.accepted.Add(1)
+		return true
+	default:
+		return false
+	}
+}
+
+// Stats returns the counters of the Batcher.
+func (b *Batcher[T]) Stats() Stats {
+	return Stats{
+		Accepted: b.accepted.Load(),
+		Dropped:  b.dropped.Load(),
+		Evicted:  b.evicted.Load(),
+		Rejected: b.rejected.Load(),
+		Buffered: len(b.ch),
+		Retries:  b.retries.Load(),
+		Failed:   b.failed.Load(),
+
+		InFlight:    b.inFlight.Get(),
+		MaxInFlight: b.inFlight.GetMax(),
+	}
+}
+
+// Flush processes the current batch straight away, and waits until it and any
+// batches still running in the background have been processed.
+func (b *Batcher[T]) Flush() {
+	reply := make(chan struct{})
+
+	select {
+	case b.flushCh <- reply:
+		<-reply
+	case <-b.done:
+	}
+}
+
+// Close stops accepting items, processes the current batch and waits for all
+// batches to be processed. If ctx is done first, Close returns ctx.Err() and the
+// context passed to the batch function is cancelled, so that retries stop.
+func (b *Batcher[T]) Close(ctx context.Context) error {
+	b.closeOnce.Do(func() {
+		// Release blocked producers before waiting for them to return
+		close(b.closing)
+
+		b.mu.Lock()
+		b.closed = true
+		b.mu.Unlock()
+
+		close(b.ch)
+	})
+
+	select {
+	case <-b.done:
+		b.cancel()
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		return ctx.Err()
+	}
+}
+
+func (b *Batcher[T]) Init(ctx context.Context) error {
+	return nil
+}
+
+// Start returns when ctx is done or the Batcher has been closed. Batches are
+// processed from the moment the Batcher is created.
+func (b *Batcher[T]) Start(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+	case <-b.done:
+	}
+
+	return nil
+}
+
+// Stop closes the Batcher, see Close.
+func (b *Batcher[T]) Stop(ctx context.Context) error {
+	return b.Close(ctx)
 }
 
 func (b *Batcher[T]) worker() {
+	defer close(b.done)
+
 	for {
 		expire := time.After(b.timeout)
-		for {
-			select {
-			case item := <-b.ch:
-				b.batch = append(b.batch, item)
 
-				if len(b.batch) == b.size {
-					goto saveBatch
+		closed, flushed := b.collect(expire)
+
+		b.saveBatch()
+
+		if flushed != nil {
+			b.wg.Wait()
+			close(flushed)
+		}
+
+		if closed {
+			b.wg.Wait()
+			return
+		}
+	}
+}
+
+// collect adds items to the batch until it is full, the timeout expires, a flush
+// is requested or the Batcher is closed.
+func (b *Batcher[T]) collect(expire <-chan time.Time) (closed bool, flushed chan struct{}) {
+	if b.carry != nil {
+		item := b.carry
+		b.carry = nil
+
+		if b.add(item, b.carryWeight) {
+			return false, nil
+		}
+	}
+
+	for {
+		select {
+		case item, ok := <-b.ch:
+			if !ok {
+				return true, nil
+			}
+
+			weight := b.itemWeight(item)
+
+			if b.weight != nil && len(b.batch) > 0 && b.batchWeight+weight > b.maxWeight {
+				// Start the next batch with this item
+				b.carry = item
+				b.carryWeight = weight
+
+				return false, nil
+			}
+
+			if b.add(item, weight) {
+				return false, nil
+			}
+
+		case <-expire:
+			return false, nil
+
+		case reply := <-b.flushCh:
+			// Include the items that were put before Flush was called
+			for n := len(b.ch); n > 0; n-- {
+				item, ok := <-b.ch
+				if !ok {
+					return true, reply
 				}
 
-			case <-expire:
-				goto saveBatch
+				// The batch may go over its limits, it is split by saveBatch
+				b.add(item, b.itemWeight(item))
+			}
+
+			return false, reply
+		}
+	}
+}
+
+// itemWeight returns the weight of item, or 0 when WithMaxWeight is not used.
+func (b *Batcher[T]) itemWeight(item *T) int {
+	if b.weight == nil {
+		return 0
+	}
+
+	return b.weight(item)
+}
+
+// add appends an item and its weight to the batch and returns true if the batch is full.
+func (b *Batcher[T]) add(item *T, weight int) bool {
+	b.batch = append(b.batch, item)
+
+	if b.weight != nil {
+		b.weights = append(b.weights, weight)
+		b.batchWeight += weight
+
+		if b.batchWeight >= b.maxWeight {
+			return true
+		}
+	}
+
+	return b.size > 0 && len(b.batch) >= b.size
+}
+
+// saveBatch processes the current batch, split into batches of at most size items
+// and, with WithMaxWeight, of at most the maximum weight.
+func (b *Batcher[T]) saveBatch() {
+	b.batchWeight = 0
+
+	for start := 0; start < len(b.batch); {
+		end := b.chunkEnd(start)
+
+		var copyBatch []*T
+
+		copyBatch = append(copyBatch, b.batch[start:end]...)
+
+		b.process(copyBatch)
+
+		start = end
+	}
+
+	b.batch = b.batch[:0] // Clear the batch slice without reallocating the underlying memory
+	b.weights = b.weights[:0]
+}
+
+// chunkEnd returns the end of the batch that starts at start. Items put before a
+// flush are added to the batch without checking its limits, so it may need splitting.
+func (b *Batcher[T]) chunkEnd(start int) int {
+	end := len(b.batch)
+	if b.size > 0 && end-start > b.size {
+		end = start + b.size
+	}
+
+	if b.weight == nil {
+		return end
+	}
+
+	total := 0
+
+	for i := start; i < end; i++ {
+		total += b.weights[i]
+
+		if total > b.maxWeight && i > start {
+			return i
+		}
+	}
+
+	return end
+}
+
+func (b *Batcher[T]) process(copyBatch []*T) {
+	if b.orderKey == nil {
+		b.run(copyBatch, nil, nil)
+		return
+	}
+
+	var keys []string
+
+	groups := make(map[string][]*T)
+
+	for _, item := range copyBatch {
+		key := b.orderKey(item)
+
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+
+		groups[key] = append(groups[key], item)
+	}
+
+	for _, key := range keys {
+		b.tailsMu.Lock()
+		prev := b.tails[key]
+		done := make(chan struct{})
+		b.tails[key] = done
+		b.tailsMu.Unlock()
+
+		k := key
+
+		b.run(groups[key], prev, func() {
+			b.tailsMu.Lock()
+			if b.tails[k] == done {
+				delete(b.tails, k)
 			}
+			b.tailsMu.Unlock()
+
+			close(done)
+		})
+	}
+}
+
+// run processes a batch once prev, if any, is closed, and then calls finish.
+// Background batches wait for a free slot first when concurrency is limited. A batch
+// with a predecessor only takes a slot once the predecessor is done, so that it does
+// not hold a slot that a batch of another key could use.
+func (b *Batcher[T]) run(batch []*T, prev <-chan struct{}, finish func()) {
+	process := func() {
+		b.inFlight.Add(1)
+		b.handle(batch)
+		b.inFlight.Add(-1)
+
+		if finish != nil {
+			finish()
 		}
-	saveBatch:
-		if len(b.batch) > 0 {
-			var copyBatch []*T
+	}
+
+	if !b.background {
+		if prev != nil {
+			<-prev
+		}
+
+		process()
+
+		return
+	}
+
+	if b.sem != nil && prev == nil {
+		b.sem <- struct{}{}
+	}
 
-			copyBatch = append(copyBatch, b.batch...)
+	b.wg.Add(1)
 
-			b.batch = b.batch[:0] // Clear the batch slice without reallocating the underlying memory
+	go func() {
+		defer b.wg.Done()
 
-			if b.background {
-				go b.fn(copyBatch)
-			} else {
-				b.fn(copyBatch)
+		if prev != nil {
+			<-prev
+
+			if b.sem != nil {
+				b.sem <- struct{}{}
 			}
 		}
+
+		if b.sem != nil {
+			defer func() { <-b.sem }()
+		}
+
+		process()
+	}()
+}
+
+// handle calls the batch function with retries, splits the batch if it still fails
+// and splitting is enabled, and dead-letters the items that cannot be processed.
+func (b *Batcher[T]) handle(batch []*T) {
+	err := b.call(batch)
+	if err == nil {
+		return
+	}
+
+	if b.split && len(batch) > 1 && b.ctx.Err() == nil {
+		mid := len(batch) / 2
+
+		b.handle(batch[:mid])
+		b.handle(batch[mid:])
+
+		return
 	}
+
+	b.failed.Add(uint64(len(batch)))
+
+	if b.deadLetter != nil {
+		b.deadLetter(batch, err)
+	}
+}
+
+func (b *Batcher[T]) call(batch []*T) error {
+	backoff := b.backoff
+
+	for attempt := 0; ; attempt++ {
+		err := b.safeCall(batch)
+		if err == nil || attempt >= b.maxRetries {
+			return err
+		}
+
+		select {
+		case <-b.ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+
+		b.retries.Add(1)
+		backoff *= 2
+	}
+}
+
+// safeCall turns a panic in the batch function into an error, so that the items
+// are dead-lettered instead of the worker crashing. Without a dead-letter function
+// nobody would see the panic, so it is passed on.
+func (b *Batcher[T]) safeCall(batch []*T) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if b.deadLetter == nil {
+				panic(r)
+			}
+
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+
+	return b.fn(b.ctx, batch)
 }
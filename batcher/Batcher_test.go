@@ -1,11 +1,21 @@
 package batcher
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/ordishs/go-utils"
+	"github.com/ordishs/go-utils/servicemanager"
 )
 
+var _ servicemanager.Service = (*Batcher[any])(nil)
+
 func TestBatcher(t *testing.T) {
 	var wg sync.WaitGroup
 
@@ -28,3 +38,719 @@ func TestBatcher(t *testing.T) {
 
 	// time.Sleep(2 * time.Second)
 }
+
+func TestBatcherFlush(t *testing.T) {
+	for _, background := range []bool{false, true} {
+		var (
+			mu      sync.Mutex
+			batches [][]*int
+		)
+
+		b := New(100, time.Hour, func(batch []*int) {
+			mu.Lock()
+			defer mu.Unlock()
+			batches = append(batches, batch)
+		}, background)
+
+		for i := 0; i < 3; i++ {
+			v := i
+			b.Put(&v)
+		}
+
+		b.Flush()
+
+		mu.Lock()
+		if len(batches) != 1 || len(batches[0]) != 3 {
+			t.Errorf("background=%v: expected one batch of 3 items after Flush, got %d batches", background, len(batches))
+		}
+		mu.Unlock()
+
+		// Flushing an empty batch does nothing
+		b.Flush()
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		mu.Lock()
+		if len(batches) != 1 {
+			t.Errorf("background=%v: expected no more batches, got %d", background, len(batches))
+		}
+		mu.Unlock()
+	}
+}
+
+func TestBatcherClose(t *testing.T) {
+	var processed atomic.Int32
+
+	b := New(100, time.Hour, func(batch []*int) {
+		time.Sleep(10 * time.Millisecond)
+		processed.Add(int32(len(batch)))
+	}, true)
+
+	for i := 0; i < 250; i++ {
+		v := i
+		b.Put(&v)
+	}
+
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := processed.Load(); n != 250 {
+		t.Errorf("expected 250 items to be processed on Close, got %d", n)
+	}
+
+	// Items put after Close are discarded, and Close and Flush can be called again
+	v := 1
+	b.Put(&v)
+	b.Flush()
+
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := processed.Load(); n != 250 {
+		t.Errorf("expected items put after Close to be discarded, got %d", n)
+	}
+}
+
+func TestBatcherCloseTimeout(t *testing.T) {
+	release := make(chan struct{})
+
+	b := New(1, time.Hour, func(batch []*int) {
+		<-release
+	}, false)
+
+	v := 1
+	b.Put(&v)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := b.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+
+	close(release)
+
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatcherService(t *testing.T) {
+	var processed atomic.Int32
+
+	b := New(100, time.Hour, func(batch []*int) {
+		processed.Add(int32(len(batch)))
+	}, false)
+
+	sm := servicemanager.NewServiceManager(servicemanager.WithLogger(utils.NopLogger{}), servicemanager.WithShutdownSignals())
+
+	if err := sm.AddService("batcher", b); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- sm.StartAllAndWait(ctx)
+	}()
+
+	if err := sm.WaitReady(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		v := i
+		b.Put(&v)
+	}
+
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if n := processed.Load(); n != 10 {
+		t.Errorf("expected pending items to be processed on shutdown, got %d", n)
+	}
+}
+
+func TestBatcherPutVariants(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 10)
+
+	var processed atomic.Int32
+
+	fn := func(batch []*int) {
+		started <- struct{}{}
+		<-release
+		processed.Add(int32(len(batch)))
+	}
+
+	b := New(1, time.Hour, fn, false, WithBufferSize[int](2))
+
+	v := 0
+	b.Put(&v)
+	<-started
+
+	// The worker is blocked in fn, so only the buffer accepts items
+	if !b.TryPut(&v) || !b.TryPut(&v) {
+		t.Fatal("expected TryPut to succeed while the buffer has room")
+	}
+
+	if b.TryPut(&v) {
+		t.Fatal("expected TryPut to fail when the buffer is full")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := b.PutCtx(ctx, &v); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+
+	stats := b.Stats()
+	if stats.Accepted != 3 || stats.Rejected != 1 || stats.Buffered != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	close(release)
+
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := processed.Load(); n != 3 {
+		t.Errorf("expected 3 items to be processed, got %d", n)
+	}
+
+	if err := b.PutCtx(context.Background(), &v); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestBatcherOverflowPolicies(t *testing.T) {
+	for _, tt := range []struct {
+		policy   OverflowPolicy
+		expected []int
+		stats    Stats
+	}{
+		{DropNewest, []int{0, 1, 2}, Stats{Accepted: 3, Dropped: 2}},
+		{DropOldest, []int{0, 3, 4}, Stats{Accepted: 5, Dropped: 2, Evicted: 2}},
+	} {
+		release := make(chan struct{})
+		started := make(chan struct{}, 10)
+
+		var (
+			mu    sync.Mutex
+			items []int
+		)
+
+		b := New(1, time.Hour, func(batch []*int) {
+			started <- struct{}{}
+			<-release
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			for _, item := range batch {
+				items = append(items, *item)
+			}
+		}, false, WithBufferSize[int](2), WithOverflowPolicy[int](tt.policy))
+
+		values := []int{0, 1, 2, 3, 4}
+
+		b.Put(&values[0])
+		<-started
+
+		for i := 1; i < len(values); i++ {
+			err := b.PutCtx(context.Background(), &values[i])
+			if tt.policy == DropNewest && i > 2 && !errors.Is(err, ErrDropped) {
+				t.Errorf("policy %d: expected ErrDropped, got %v", tt.policy, err)
+			}
+		}
+
+		// Evicted items were accepted first, so only Accepted - Evicted items reach the batch function
+		if stats := b.Stats(); stats.Accepted != tt.stats.Accepted || stats.Dropped != tt.stats.Dropped || stats.Evicted != tt.stats.Evicted {
+			t.Errorf("policy %d: expected %+v, got %+v", tt.policy, tt.stats, stats)
+		}
+
+		close(release)
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		mu.Lock()
+		if len(items) != len(tt.expected) {
+			t.Errorf("policy %d: expected %v, got %v", tt.policy, tt.expected, items)
+		} else {
+			for i := range items {
+				if items[i] != tt.expected[i] {
+					t.Errorf("policy %d: expected %v, got %v", tt.policy, tt.expected, items)
+					break
+				}
+			}
+		}
+		mu.Unlock()
+	}
+}
+
+func TestBatcherFlushIncludesBuffer(t *testing.T) {
+	var sizes []int
+
+	var mu sync.Mutex
+
+	b := New(2, time.Hour, func(batch []*int) {
+		mu.Lock()
+		defer mu.Unlock()
+		sizes = append(sizes, len(batch))
+	}, false, WithBufferSize[int](10))
+
+	for i := 0; i < 5; i++ {
+		v := i
+		b.Put(&v)
+	}
+
+	b.Flush()
+
+	mu.Lock()
+	total := 0
+	for _, n := range sizes {
+		total += n
+		if n > 2 {
+			t.Errorf("batch of %d items exceeds the batch size", n)
+		}
+	}
+	mu.Unlock()
+
+	if total != 5 {
+		t.Errorf("expected Flush to process all 5 buffered items, got %d", total)
+	}
+
+	_ = b.Close(context.Background())
+}
+
+func TestBatcherRetriesAndDeadLetter(t *testing.T) {
+	var calls atomic.Int32
+
+	var (
+		mu         sync.Mutex
+		deadLetter []int
+	)
+
+	poison := 13
+	errPoison := errors.New("poison item")
+
+	b := NewWithError(8, time.Hour, func(ctx context.Context, batch []*int) error {
+		calls.Add(1)
+
+		for _, item := range batch {
+			if *item == poison {
+				return errPoison
+			}
+		}
+
+		return nil
+	}, false,
+		WithRetries[int](1, time.Millisecond),
+		WithSplitting[int](),
+		WithDeadLetter(func(items []*int, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if !errors.Is(err, errPoison) {
+				t.Errorf("unexpected error %v", err)
+			}
+
+			for _, item := range items {
+				deadLetter = append(deadLetter, *item)
+			}
+		}),
+	)
+
+	for i := 10; i < 18; i++ {
+		v := i
+		b.Put(&v)
+	}
+
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	if len(deadLetter) != 1 || deadLetter[0] != poison {
+		t.Errorf("expected only the poison item to be dead-lettered, got %v", deadLetter)
+	}
+	mu.Unlock()
+
+	stats := b.Stats()
+	if stats.Failed != 1 {
+		t.Errorf("expected 1 failed item, got %d", stats.Failed)
+	}
+
+	// 8 -> 4 -> 2 -> 1 items: every failing batch is called twice
+	if stats.Retries != 4 {
+		t.Errorf("expected 4 retries, got %d", stats.Retries)
+	}
+}
+
+func TestBatcherDeadLettersPanics(t *testing.T) {
+	var deadLetter error
+
+	b := New(2, time.Hour, func(batch []*int) {
+		panic("boom")
+	}, false, WithDeadLetter(func(items []*int, err error) {
+		deadLetter = err
+	}))
+
+	v := 1
+	b.Put(&v)
+
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if deadLetter == nil || !strings.HasPrefix(deadLetter.Error(), "panic: boom") {
+		t.Fatalf("expected the panic to be dead-lettered, got %v", deadLetter)
+	}
+
+	// The stack of the panic is included so that it can be logged
+	if !strings.Contains(deadLetter.Error(), "TestBatcherDeadLettersPanics") {
+		t.Errorf("expected the stack in the error, got %v", deadLetter)
+	}
+
+	if stats := b.Stats(); stats.Failed != 1 {
+		t.Errorf("expected 1 failed item, got %d", stats.Failed)
+	}
+}
+
+func TestBatcherRetrySucceeds(t *testing.T) {
+	var calls atomic.Int32
+
+	b := NewWithError(10, time.Hour, func(ctx context.Context, batch []*int) error {
+		if calls.Add(1) < 3 {
+			return errors.New("transient")
+		}
+
+		return nil
+	}, false, WithRetries[int](5, time.Millisecond))
+
+	v := 1
+	b.Put(&v)
+
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := b.Stats(); stats.Retries != 2 || stats.Failed != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestBatcherMaxConcurrentBatches(t *testing.T) {
+	var running, maxRunning atomic.Int32
+
+	b := New(1, time.Hour, func(batch []*int) {
+		n := running.Add(1)
+		defer running.Add(-1)
+
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}, true, WithMaxConcurrentBatches[int](2))
+
+	for i := 0; i < 20; i++ {
+		v := i
+		b.Put(&v)
+	}
+
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := maxRunning.Load(); n != 2 {
+		t.Errorf("expected at most 2 concurrent batches, got %d", n)
+	}
+
+	stats := b.Stats()
+	if stats.InFlight != 0 || stats.MaxInFlight != 2 {
+		t.Errorf("unexpected in-flight stats %+v", stats)
+	}
+}
+
+func TestBatcherBackpressure(t *testing.T) {
+	release := make(chan struct{})
+
+	b := New(1, time.Hour, func(batch []*int) {
+		<-release
+	}, true, WithMaxConcurrentBatches[int](1), WithBufferSize[int](1))
+
+	v := 1
+
+	// One batch is processed, one is waiting for a slot and one item is buffered
+	for i := 0; i < 3; i++ {
+		if err := b.PutCtx(context.Background(), &v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	if b.TryPut(&v) {
+		t.Error("expected TryPut to fail while all batch slots are busy")
+	}
+
+	close(release)
+
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatcherOrderingKey(t *testing.T) {
+	type item struct {
+		key   string
+		value int
+	}
+
+	var (
+		mu      sync.Mutex
+		seen    = make(map[string][]int)
+		batches atomic.Int32
+	)
+
+	b := New(3, time.Hour, func(batch []*item) {
+		// Later batches finish first unless they are ordered
+		time.Sleep(time.Duration(10-batches.Add(1)%10) * time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, it := range batch {
+			if it.key != batch[0].key {
+				t.Errorf("batch mixes keys %s and %s", batch[0].key, it.key)
+			}
+
+			seen[it.key] = append(seen[it.key], it.value)
+		}
+	}, true, WithOrderingKey(func(it *item) string { return it.key }))
+
+	for i := 0; i < 30; i++ {
+		b.Put(&item{key: []string{"a", "b", "c"}[i%3], value: i})
+	}
+
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, values := range seen {
+		if len(values) != 10 {
+			t.Errorf("key %s: expected 10 items, got %d", key, len(values))
+		}
+
+		for i := 1; i < len(values); i++ {
+			if values[i] < values[i-1] {
+				t.Errorf("key %s: items processed out of order: %v", key, values)
+				break
+			}
+		}
+	}
+}
+
+func TestBatcherOrderingKeyDoesNotHoldSlots(t *testing.T) {
+	type item struct {
+		key   string
+		value int
+	}
+
+	release := make(chan struct{})
+	processed := make(chan string, 3)
+
+	b := New(1, time.Hour, func(batch []*item) {
+		if batch[0].value == 0 {
+			<-release
+		}
+
+		processed <- fmt.Sprintf("%s%d", batch[0].key, batch[0].value)
+	}, true, WithMaxConcurrentBatches[item](2), WithOrderingKey(func(it *item) string { return it.key }))
+
+	// a1 waits for a0, which is blocked, but must not take the second slot from b2
+	b.Put(&item{key: "a", value: 0})
+	b.Put(&item{key: "a", value: 1})
+	b.Put(&item{key: "b", value: 2})
+
+	select {
+	case got := <-processed:
+		if got != "b2" {
+			t.Errorf("expected b2 to be processed first, got %s", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("b2 was not processed while a0 was blocked")
+	}
+
+	close(release)
+
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if first, second := <-processed, <-processed; first != "a0" || second != "a1" {
+		t.Errorf("expected a0 before a1, got %s and %s", first, second)
+	}
+}
+
+func TestBatcherMaxWeight(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		batches     [][]int
+		weightCalls atomic.Int32
+	)
+
+	b := New(100, time.Hour, func(batch []*int) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		var sizes []int
+		for _, item := range batch {
+			sizes = append(sizes, *item)
+		}
+
+		batches = append(batches, sizes)
+	}, false, WithMaxWeight(1000, func(item *int) int {
+		weightCalls.Add(1)
+		return *item
+	}))
+
+	sizes := []int{200, 300, 400, 200, 5000, 100, 900, 50}
+
+	for _, size := range sizes {
+		v := size
+		b.Put(&v)
+	}
+
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Items carried over to the next batch are not weighed again
+	if calls := weightCalls.Load(); calls != int32(len(sizes)) {
+		t.Errorf("expected %d calls to the weight function, got %d", len(sizes), calls)
+	}
+
+	expected := [][]int{
+		{200, 300, 400}, // 1100 would exceed the limit
+		{200},           // The next item is heavier than the limit
+		{5000},
+		{100, 900}, // Reaches the limit exactly
+		{50},
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(batches) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, batches)
+	}
+
+	for i := range expected {
+		if len(batches[i]) != len(expected[i]) {
+			t.Fatalf("expected %v, got %v", expected, batches)
+		}
+
+		for j := range expected[i] {
+			if batches[i][j] != expected[i][j] {
+				t.Fatalf("expected %v, got %v", expected, batches)
+			}
+		}
+	}
+}
+
+func TestBatcherFlushSplitsByWeight(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		weights     []int
+		weightCalls atomic.Int32
+	)
+
+	b := New(100, time.Hour, func(batch []*int) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		total := 0
+		for _, item := range batch {
+			total += *item
+		}
+
+		weights = append(weights, total)
+	}, false, WithBufferSize[int](10), WithMaxWeight(10, func(item *int) int {
+		weightCalls.Add(1)
+		return *item
+	}))
+
+	for _, w := range []int{4, 4, 4, 4, 20} {
+		v := w
+		b.Put(&v)
+	}
+
+	b.Flush()
+
+	mu.Lock()
+	total := 0
+	for _, w := range weights {
+		total += w
+	}
+	if total != 36 {
+		t.Errorf("expected all items to be flushed, got total weight %d in %v", total, weights)
+	}
+	for _, w := range weights {
+		if w > 10 && w != 20 {
+			t.Errorf("batch weight %d exceeds the limit: %v", w, weights)
+		}
+	}
+	mu.Unlock()
+
+	// Splitting a flushed batch uses the weights computed when the items were added
+	if calls := weightCalls.Load(); calls != 5 {
+		t.Errorf("expected 5 calls to the weight function, got %d", calls)
+	}
+
+	_ = b.Close(context.Background())
+}
+
+func TestBatcherZeroSizeFlushesOnTimeoutOnly(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		batches []int
+	)
+
+	b := New(0, 50*time.Millisecond, func(batch []*int) {
+		mu.Lock()
+		defer mu.Unlock()
+		batches = append(batches, len(batch))
+	}, false)
+
+	for i := 0; i < 10; i++ {
+		v := i
+		b.Put(&v)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	mu.Lock()
+	if len(batches) != 1 || batches[0] != 10 {
+		t.Errorf("expected one batch of 10 items, got %v", batches)
+	}
+	mu.Unlock()
+
+	_ = b.Close(context.Background())
+}
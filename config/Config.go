@@ -0,0 +1,306 @@
+// Package config populates typed configuration structs from defaults, YAML and JSON
+// files, environment variables and command line flags, and validates the result.
+//
+// Values are applied in this order, later sources overriding earlier ones:
+//
+//  1. the default tag of each field
+//  2. the configuration files, in the order they were given
+//  3. environment variables
+//  4. command line flags
+//
+// Fields are named in files by their yaml tag for YAML files and by their json tag
+// for JSON files. Durations are written as "5s" in YAML files and as nanoseconds in
+// JSON files. Nested structs are sections. A field is read from the environment
+// variable in its env tag, and, when an environment prefix is set, from a variable
+// derived from the prefix and the field path, for example APP_GRPC_MAX_RETRIES for
+// the field MaxRetries of the section GRPC with the prefix APP. A field is set by the
+// command line flag named in its flag tag. Fields are validated with the rules in
+// their validate tag, see Load.
+//
+//	type Config struct {
+//		Listen  string        `yaml:"listen" env:"LISTEN" flag:"listen" default:":8080" validate:"required"`
+//		Timeout time.Duration `yaml:"timeout" default:"5s" validate:"min=1s"`
+//		GRPC    config.GRPC   `yaml:"grpc"`
+//	}
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Option configures a Loader.
+type Option func(l *Loader)
+
+// WithFile reads configuration from the file at path. The format is chosen by the
+// extension: .json for JSON, anything else is read as YAML.
+func WithFile(path string) Option {
+	return func(l *Loader) {
+		l.files = append(l.files, fileSource{path: path})
+	}
+}
+
+// WithOptionalFile is like WithFile but ignores the file if it does not exist.
+func WithOptionalFile(path string) Option {
+	return func(l *Loader) {
+		l.files = append(l.files, fileSource{path: path, optional: true})
+	}
+}
+
+// WithEnvPrefix reads every field from an environment variable named after the
+// prefix and the path of the field, in addition to the names in env tags.
+func WithEnvPrefix(prefix string) Option {
+	return func(l *Loader) {
+		l.envPrefix = strings.TrimSuffix(prefix, "_")
+	}
+}
+
+// WithFlags registers a flag on fs for every field with a flag tag and parses args.
+// Flags are registered and parsed once, when Load is first called.
+func WithFlags(fs *flag.FlagSet, args []string) Option {
+	return func(l *Loader) {
+		l.flagSet = fs
+		l.args = args
+	}
+}
+
+// WithLookupEnv replaces os.LookupEnv, which is useful in tests.
+func WithLookupEnv(lookup func(key string) (string, bool)) Option {
+	return func(l *Loader) {
+		l.lookupEnv = lookup
+	}
+}
+
+type fileSource struct {
+	path     string
+	optional bool
+}
+
+// Loader loads configuration into structs. It can be used repeatedly, for example
+// by a Watcher, to reload the configuration when a file changes.
+type Loader struct {
+	files     []fileSource
+	envPrefix string
+	lookupEnv func(key string) (string, bool)
+	flagSet   *flag.FlagSet
+	args      []string
+
+	mu     sync.Mutex
+	parsed bool
+	flags  map[string]*flagValue // Flag name to the value given on the command line
+}
+
+// NewLoader creates a Loader.
+func NewLoader(opts ...Option) *Loader {
+	l := &Loader{
+		lookupEnv: os.LookupEnv,
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
+}
+
+// Load populates cfg, which must be a pointer to a struct, and validates it.
+//
+// The validate tag holds a comma separated list of rules:
+//
+//	required    the value must not be the zero value
+//	min=N       numbers and durations must be at least N, strings and slices must have at least N elements
+//	max=N       numbers and durations must be at most N, strings and slices must have at most N elements
+//	oneof=a b c the value must be one of the space separated values
+//
+// All validation failures are returned together.
+func Load(cfg interface{}, opts ...Option) error {
+	return NewLoader(opts...).Load(cfg)
+}
+
+// Load populates cfg, which must be a pointer to a struct, and validates it.
+func (l *Loader) Load(cfg interface{}) error {
+	fs, err := fields(cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := applyDefaults(fs); err != nil {
+		return err
+	}
+
+	for _, f := range l.files {
+		if err := loadFile(f, cfg); err != nil {
+			return err
+		}
+	}
+
+	if err := l.applyEnv(fs); err != nil {
+		return err
+	}
+
+	if err := l.applyFlags(fs); err != nil {
+		return err
+	}
+
+	return validate(fs)
+}
+
+// Files returns the paths of the configuration files.
+func (l *Loader) Files() []string {
+	paths := make([]string, 0, len(l.files))
+	for _, f := range l.files {
+		paths = append(paths, f.path)
+	}
+
+	return paths
+}
+
+func applyDefaults(fs []field) error {
+	for _, f := range fs {
+		def, ok := f.tag.Lookup("default")
+		if !ok || !f.value.IsZero() {
+			continue
+		}
+
+		if err := setString(f.value, def); err != nil {
+			return fmt.Errorf("%s: invalid default %q: %w", f.name(), def, err)
+		}
+	}
+
+	return nil
+}
+
+func loadFile(f fileSource, cfg interface{}) error {
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		if f.optional && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	if strings.EqualFold(filepath.Ext(f.path), ".json") {
+		err = json.Unmarshal(b, cfg)
+	} else {
+		err = yaml.Unmarshal(b, cfg)
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not parse %s: %w", f.path, err)
+	}
+
+	return nil
+}
+
+func (l *Loader) applyEnv(fs []field) error {
+	for _, f := range fs {
+		var keys []string
+
+		if l.envPrefix != "" {
+			keys = append(keys, l.envPrefix+"_"+strings.Join(f.envKey, "_"))
+		}
+
+		// The explicit name takes precedence over the derived one
+		if key, ok := f.tag.Lookup("env"); ok && key != "" {
+			keys = append(keys, key)
+		}
+
+		for _, key := range keys {
+			s, ok := l.lookupEnv(key)
+			if !ok {
+				continue
+			}
+
+			if err := setString(f.value, s); err != nil {
+				return fmt.Errorf("%s: invalid value %q in %s: %w", f.name(), s, key, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// flagValue records the value of a flag given on the command line, so that it can
+// be applied every time the configuration is loaded.
+type flagValue struct {
+	value string
+	set   bool
+	def   string
+}
+
+func (v *flagValue) String() string {
+	if v == nil {
+		return ""
+	}
+
+	if v.set {
+		return v.value
+	}
+
+	return v.def
+}
+
+func (v *flagValue) Set(s string) error {
+	v.value = s
+	v.set = true
+
+	return nil
+}
+
+func (l *Loader) applyFlags(fs []field) error {
+	if l.flagSet == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.parsed {
+		l.flags = make(map[string]*flagValue)
+
+		for _, f := range fs {
+			name, ok := f.tag.Lookup("flag")
+			if !ok || name == "" {
+				continue
+			}
+
+			v := &flagValue{def: fmt.Sprint(f.value.Interface())}
+			l.flags[name] = v
+
+			usage := f.tag.Get("usage")
+			if usage == "" {
+				usage = f.name()
+			}
+
+			l.flagSet.Var(v, name, usage)
+		}
+
+		if err := l.flagSet.Parse(l.args); err != nil {
+			return err
+		}
+
+		l.parsed = true
+	}
+
+	for _, f := range fs {
+		v := l.flags[f.tag.Get("flag")]
+		if v == nil || !v.set {
+			continue
+		}
+
+		if err := setString(f.value, v.value); err != nil {
+			return fmt.Errorf("%s: invalid value %q for flag -%s: %w", f.name(), v.value, f.tag.Get("flag"), err)
+		}
+	}
+
+	return nil
+}
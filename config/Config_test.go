@@ -0,0 +1,132 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testConfig struct {
+	Name    string        `yaml:"name" json:"name" env:"NAME" flag:"name" validate:"required"`
+	Port    int           `yaml:"port" json:"port" default:"8080" validate:"min=1,max=65535"`
+	Timeout time.Duration `yaml:"timeout" json:"timeout" default:"5s" flag:"timeout"`
+	Mode    string        `yaml:"mode" json:"mode" default:"dev" validate:"oneof=dev prod"`
+	Peers   []string      `yaml:"peers" json:"peers"`
+	GRPC    GRPC          `yaml:"grpc" json:"grpc"`
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	return path
+}
+
+func env(vars map[string]string) Option {
+	return WithLookupEnv(func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	})
+}
+
+func TestLoadDefaults(t *testing.T) {
+	var cfg testConfig
+
+	require.NoError(t, Load(&cfg, env(map[string]string{"NAME": "svc"})))
+
+	assert.Equal(t, "svc", cfg.Name)
+	assert.Equal(t, 8080, cfg.Port)
+	assert.Equal(t, 5*time.Second, cfg.Timeout)
+	assert.Equal(t, "dev", cfg.Mode)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	yamlFile := writeFile(t, "config.yaml", `
+name: from-yaml
+port: 9000
+timeout: 1m
+peers: [a, b]
+grpc:
+  securityLevel: 1
+  maxRetries: 3
+  retryBackoff: 2s
+`)
+
+	jsonFile := writeFile(t, "override.json", `{"port": 9001, "grpc": {"caCertFile": "ca.pem"}}`)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+
+	var cfg testConfig
+
+	require.NoError(t, Load(&cfg,
+		WithFile(yamlFile),
+		WithFile(jsonFile),
+		WithOptionalFile(filepath.Join(t.TempDir(), "missing.yaml")),
+		WithEnvPrefix("APP"),
+		env(map[string]string{
+			"APP_MODE":             "prod",
+			"APP_GRPC_MAX_RETRIES": "5",
+			"NAME":                 "from-env",
+		}),
+		WithFlags(fs, []string{"-name", "from-flag"}),
+	))
+
+	assert.Equal(t, "from-flag", cfg.Name)
+	assert.Equal(t, 9001, cfg.Port)
+	assert.Equal(t, time.Minute, cfg.Timeout)
+	assert.Equal(t, "prod", cfg.Mode)
+	assert.Equal(t, []string{"a", "b"}, cfg.Peers)
+
+	assert.Equal(t, 1, cfg.GRPC.SecurityLevel)
+	assert.Equal(t, "ca.pem", cfg.GRPC.CaCertFile)
+	assert.Equal(t, 5, cfg.GRPC.MaxRetries)
+
+	opts := cfg.GRPC.ConnectionOptions()
+	assert.Equal(t, 1, opts.SecurityLevel)
+	assert.Equal(t, "ca.pem", opts.CaCertFile)
+	assert.Equal(t, 5, opts.MaxRetries)
+	assert.Equal(t, 2*time.Second, opts.RetryBackoff)
+}
+
+func TestLoadValidation(t *testing.T) {
+	file := writeFile(t, "config.yaml", `
+port: 70000
+mode: staging
+grpc:
+  securityLevel: 4
+`)
+
+	var cfg testConfig
+
+	err := Load(&cfg, WithFile(file), env(nil))
+	require.Error(t, err)
+
+	assert.ErrorContains(t, err, "name: is required")
+	assert.ErrorContains(t, err, "port: must be at most 65535")
+	assert.ErrorContains(t, err, "mode: must be one of dev, prod")
+	assert.ErrorContains(t, err, "grpc.securityLevel: must be at most 3")
+}
+
+func TestLoadErrors(t *testing.T) {
+	var cfg testConfig
+
+	assert.Error(t, Load(cfg))
+	assert.Error(t, Load(&cfg, WithFile(filepath.Join(t.TempDir(), "missing.yaml"))))
+	assert.Error(t, Load(&cfg, WithFile(writeFile(t, "bad.yaml", "port: [")), env(nil)))
+	assert.ErrorContains(t, Load(&cfg, env(map[string]string{"NAME": "x", "APP_PORT": "abc"}), WithEnvPrefix("APP")), "APP_PORT")
+}
+
+func TestUpperSnake(t *testing.T) {
+	assert.Equal(t, "MAX_MESSAGE_SIZE", upperSnake("MaxMessageSize"))
+	assert.Equal(t, "GRPC", upperSnake("GRPC"))
+	assert.Equal(t, "GRPC_ADDRESS", upperSnake("GRPCAddress"))
+	assert.Equal(t, "CA_CERT_FILE", upperSnake("CaCertFile"))
+	assert.Equal(t, "PORT2", upperSnake("Port2"))
+}
@@ -0,0 +1,181 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// field is a settable leaf of a configuration struct.
+type field struct {
+	path   []string // Names of the field and its parent sections
+	tag    reflect.StructTag
+	value  reflect.Value
+	envKey []string // Field names used to derive the environment variable name
+}
+
+func (f field) name() string {
+	return strings.Join(f.path, ".")
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// fields returns the leaves of the struct v points to. Nested structs are sections
+// and are walked recursively.
+func fields(v interface{}) ([]field, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config must be a non-nil pointer to a struct, got %T", v)
+	}
+
+	var result []field
+
+	walk(rv.Elem(), nil, nil, &result)
+
+	return result, nil
+}
+
+func walk(v reflect.Value, path []string, envKey []string, result *[]field) {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		name := fieldName(sf)
+		if name == "-" {
+			continue
+		}
+
+		fv := v.Field(i)
+		p := append(append([]string{}, path...), name)
+		e := append(append([]string{}, envKey...), upperSnake(sf.Name))
+
+		if fv.Kind() == reflect.Struct && fv.Type() != reflect.TypeOf(time.Time{}) {
+			walk(fv, p, e, result)
+			continue
+		}
+
+		*result = append(*result, field{
+			path:   p,
+			tag:    sf.Tag,
+			value:  fv,
+			envKey: e,
+		})
+	}
+}
+
+// fieldName returns the name used in files and error messages: the yaml or json
+// tag name if there is one, otherwise the Go field name.
+func fieldName(sf reflect.StructField) string {
+	for _, key := range []string{"yaml", "json"} {
+		if tag, ok := sf.Tag.Lookup(key); ok {
+			name, _, _ := strings.Cut(tag, ",")
+			if name != "" {
+				return name
+			}
+		}
+	}
+
+	return sf.Name
+}
+
+// upperSnake converts a Go field name such as MaxMessageSize to MAX_MESSAGE_SIZE.
+func upperSnake(s string) string {
+	var sb strings.Builder
+
+	runes := []rune(s)
+
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				sb.WriteByte('_')
+			}
+		}
+
+		sb.WriteRune(unicode.ToUpper(r))
+	}
+
+	return sb.String()
+}
+
+// setString parses s into v. Slices are parsed from comma separated values.
+func setString(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+
+		v.SetInt(int64(d))
+
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+
+		v.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		v.SetInt(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		v.SetUint(n)
+
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		v.SetFloat(f)
+
+	case reflect.Slice:
+		var parts []string
+
+		if s != "" {
+			parts = strings.Split(s, ",")
+		}
+
+		slice := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+
+		for i, part := range parts {
+			if err := setString(slice.Index(i), strings.TrimSpace(part)); err != nil {
+				return err
+			}
+		}
+
+		v.Set(slice)
+
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"time"
+
+	"github.com/ordishs/go-utils"
+)
+
+// GRPC is a configuration section for a gRPC client or server.
+type GRPC struct {
+	Address        string        `yaml:"address" json:"address"`
+	MaxMessageSize int           `yaml:"maxMessageSize" json:"maxMessageSize" validate:"min=0"`
+	SecurityLevel  int           `yaml:"securityLevel" json:"securityLevel" validate:"min=0,max=3"`
+	CertFile       string        `yaml:"certFile" json:"certFile"`
+	KeyFile        string        `yaml:"keyFile" json:"keyFile"`
+	CaCertFile     string        `yaml:"caCertFile" json:"caCertFile"`
+	OpenTelemetry  bool          `yaml:"openTelemetry" json:"openTelemetry"`
+	OpenTracing    bool          `yaml:"openTracing" json:"openTracing"`
+	Prometheus     bool          `yaml:"prometheus" json:"prometheus"`
+	MaxRetries     int           `yaml:"maxRetries" json:"maxRetries" validate:"min=0"`
+	RetryBackoff   time.Duration `yaml:"retryBackoff" json:"retryBackoff" validate:"min=0s"`
+}
+
+// ConnectionOptions returns the section as ConnectionOptions for GetGRPCClient and
+// GetGRPCServer. Use its AsClientOptions or AsServerOptions methods with NewGRPCClient
+// and NewGRPCServer.
+func (g GRPC) ConnectionOptions() *utils.ConnectionOptions {
+	return &utils.ConnectionOptions{
+		MaxMessageSize: g.MaxMessageSize,
+		SecurityLevel:  g.SecurityLevel,
+		OpenTelemetry:  g.OpenTelemetry,
+		OpenTracing:    g.OpenTracing,
+		Prometheus:     g.Prometheus,
+		CertFile:       g.CertFile,
+		CaCertFile:     g.CaCertFile,
+		KeyFile:        g.KeyFile,
+		MaxRetries:     g.MaxRetries,
+		RetryBackoff:   g.RetryBackoff,
+	}
+}
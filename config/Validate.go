@@ -0,0 +1,104 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// validate checks the rules in the validate tag of every field, see Load, and returns
+// all violations joined together.
+func validate(fs []field) error {
+	var errs []error
+
+	for _, f := range fs {
+		rules, ok := f.tag.Lookup("validate")
+		if !ok || rules == "" {
+			continue
+		}
+
+		for _, rule := range strings.Split(rules, ",") {
+			if err := checkRule(f.value, rule); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", f.name(), err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func checkRule(v reflect.Value, rule string) error {
+	name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+
+	switch name {
+	case "required":
+		if v.IsZero() {
+			return errors.New("is required")
+		}
+
+	case "min", "max":
+		limit, err := number(v, arg)
+		if err != nil {
+			return fmt.Errorf("invalid %s rule: %w", name, err)
+		}
+
+		actual, err := measure(v)
+		if err != nil {
+			return err
+		}
+
+		if name == "min" && actual < limit {
+			return fmt.Errorf("must be at least %s", arg)
+		}
+
+		if name == "max" && actual > limit {
+			return fmt.Errorf("must be at most %s", arg)
+		}
+
+	case "oneof":
+		actual := fmt.Sprint(v.Interface())
+
+		for _, allowed := range strings.Fields(arg) {
+			if actual == allowed {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("must be one of %s", strings.Join(strings.Fields(arg), ", "))
+
+	default:
+		return fmt.Errorf("unknown validation rule %q", name)
+	}
+
+	return nil
+}
+
+// measure returns the value of numbers and the length of strings and slices.
+func measure(v reflect.Value) (float64, error) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String, reflect.Slice, reflect.Map:
+		return float64(v.Len()), nil
+	default:
+		return 0, fmt.Errorf("min and max are not supported for %s", v.Type())
+	}
+}
+
+// number parses the argument of a min or max rule. Limits for durations are
+// written as durations, for example min=1s.
+func number(v reflect.Value, arg string) (float64, error) {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(arg)
+		return float64(d), err
+	}
+
+	return strconv.ParseFloat(arg, 64)
+}
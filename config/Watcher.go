@@ -0,0 +1,230 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ordishs/go-utils"
+	"github.com/ordishs/go-utils/servicemanager"
+)
+
+const defaultWatchInterval = 5 * time.Second
+
+// Reloader is implemented by services that apply a new configuration without
+// being restarted.
+type Reloader[T any] interface {
+	ReloadConfig(ctx context.Context, cfg *T) error
+}
+
+// ReloaderFunc adapts a function to the Reloader interface.
+type ReloaderFunc[T any] func(ctx context.Context, cfg *T) error
+
+func (f ReloaderFunc[T]) ReloadConfig(ctx context.Context, cfg *T) error {
+	return f(ctx, cfg)
+}
+
+// ForReloadable returns a Reloader that calls Reload on a servicemanager.Reloadable
+// service when the configuration changes, for services that read the configuration
+// themselves.
+func ForReloadable[T any](r servicemanager.Reloadable) Reloader[T] {
+	return ReloaderFunc[T](func(ctx context.Context, _ *T) error {
+		return r.Reload(ctx)
+	})
+}
+
+// WatcherOption configures a Watcher.
+type WatcherOption func(w *watcherOptions)
+
+type watcherOptions struct {
+	interval time.Duration
+	logger   utils.Logger
+}
+
+// WithInterval sets how often the configuration files are checked for changes.
+// The default is 5 seconds.
+func WithInterval(interval time.Duration) WatcherOption {
+	return func(o *watcherOptions) {
+		o.interval = interval
+	}
+}
+
+// WithLogger sets the logger used to report configuration that fails to load.
+// The default logs to slog.Default().
+func WithLogger(logger utils.Logger) WatcherOption {
+	return func(o *watcherOptions) {
+		o.logger = logger
+	}
+}
+
+// Watcher loads a configuration and reloads it when one of its files changes,
+// delivering every valid new configuration to the subscribed Reloaders.
+// A configuration that fails to load or validate is logged and ignored.
+// Watcher implements servicemanager.Service: Init loads the configuration and
+// Start polls the files until its context is cancelled.
+type Watcher[T any] struct {
+	loader   *Loader
+	interval time.Duration
+	logger   utils.Logger
+
+	mu        sync.RWMutex
+	current   *T
+	stamps    []fileStamp
+	reloaders []Reloader[T]
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	exists  bool
+}
+
+// NewWatcher creates a Watcher that loads the configuration with loader.
+func NewWatcher[T any](loader *Loader, opts ...WatcherOption) *Watcher[T] {
+	o := watcherOptions{
+		interval: defaultWatchInterval,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.logger == nil {
+		o.logger = utils.NewSlogLogger(slog.Default().With("component", "config"))
+	}
+
+	return &Watcher[T]{
+		loader:   loader,
+		interval: o.interval,
+		logger:   o.logger,
+	}
+}
+
+var _ servicemanager.Service = (*Watcher[struct{}])(nil)
+
+// Current returns the configuration that was loaded last. It must not be modified.
+func (w *Watcher[T]) Current() *T {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.current
+}
+
+// Subscribe delivers every new configuration to r.
+func (w *Watcher[T]) Subscribe(r Reloader[T]) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.reloaders = append(w.reloaders, r)
+}
+
+// Init loads the configuration. An error is returned if it fails to load or validate.
+func (w *Watcher[T]) Init(ctx context.Context) error {
+	stamps := w.stat()
+
+	cfg := new(T)
+	if err := w.loader.Load(cfg); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	w.current = cfg
+	w.stamps = stamps
+	w.mu.Unlock()
+
+	return nil
+}
+
+// Start checks the configuration files for changes until ctx is cancelled.
+func (w *Watcher[T]) Start(ctx context.Context) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if _, err := w.Check(ctx); err != nil {
+				w.logger.Errorf("Failed to reload configuration: %v", err)
+			}
+		}
+	}
+}
+
+func (w *Watcher[T]) Stop(ctx context.Context) error {
+	return nil
+}
+
+// Check reloads the configuration if a file has changed since it was last loaded and
+// delivers it to the subscribers. It returns true if a new configuration was loaded.
+// Errors returned by subscribers are joined together; every subscriber is called.
+func (w *Watcher[T]) Check(ctx context.Context) (bool, error) {
+	stamps := w.stat()
+
+	w.mu.RLock()
+	changed := !equalStamps(stamps, w.stamps)
+	w.mu.RUnlock()
+
+	if !changed {
+		return false, nil
+	}
+
+	cfg := new(T)
+	err := w.loader.Load(cfg)
+
+	w.mu.Lock()
+
+	// Do not retry a broken file until it changes again
+	w.stamps = stamps
+
+	if err != nil {
+		w.mu.Unlock()
+		return false, err
+	}
+
+	w.current = cfg
+	reloaders := append([]Reloader[T]{}, w.reloaders...)
+
+	w.mu.Unlock()
+
+	var errs []error
+
+	for _, r := range reloaders {
+		if err := r.ReloadConfig(ctx, cfg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return true, errors.Join(errs...)
+}
+
+func (w *Watcher[T]) stat() []fileStamp {
+	paths := w.loader.Files()
+	stamps := make([]fileStamp, len(paths))
+
+	for i, path := range paths {
+		if fi, err := os.Stat(path); err == nil {
+			stamps[i] = fileStamp{modTime: fi.ModTime(), size: fi.Size(), exists: true}
+		}
+	}
+
+	return stamps
+}
+
+func equalStamps(a, b []fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].exists != b[i].exists || a[i].size != b[i].size || !a[i].modTime.Equal(b[i].modTime) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ordishs/go-utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type reloadableService struct {
+	reloads int
+}
+
+func (s *reloadableService) Reload(ctx context.Context) error {
+	s.reloads++
+	return nil
+}
+
+func TestWatcher(t *testing.T) {
+	file := writeFile(t, "config.yaml", "name: first\n")
+
+	w := NewWatcher[testConfig](NewLoader(WithFile(file), env(nil)), WithLogger(utils.NopLogger{}))
+
+	var delivered []string
+
+	w.Subscribe(ReloaderFunc[testConfig](func(ctx context.Context, cfg *testConfig) error {
+		delivered = append(delivered, cfg.Name)
+		return nil
+	}))
+
+	svc := &reloadableService{}
+	w.Subscribe(ForReloadable[testConfig](svc))
+
+	require.NoError(t, w.Init(context.Background()))
+	assert.Equal(t, "first", w.Current().Name)
+
+	changed, err := w.Check(context.Background())
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	write := func(content string) {
+		require.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+
+		// Make sure the modification time changes on file systems with coarse timestamps
+		later := time.Now().Add(time.Duration(len(delivered)+1) * time.Second)
+		require.NoError(t, os.Chtimes(file, later, later))
+	}
+
+	write("name: second\n")
+
+	changed, err = w.Check(context.Background())
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "second", w.Current().Name)
+
+	// An invalid configuration is ignored
+	write("port: 0\n")
+
+	changed, err = w.Check(context.Background())
+	assert.ErrorContains(t, err, "name: is required")
+	assert.False(t, changed)
+	assert.Equal(t, "second", w.Current().Name)
+
+	assert.Equal(t, []string{"second"}, delivered)
+	assert.Equal(t, 1, svc.reloads)
+}
+
+func TestWatcherInitFails(t *testing.T) {
+	w := NewWatcher[testConfig](NewLoader(WithFile(writeFile(t, "config.yaml", "port: 1\n")), env(nil)))
+
+	assert.ErrorContains(t, w.Init(context.Background()), "name: is required")
+}
@@ -0,0 +1,272 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule is a Schedule parsed from a standard five field cron expression:
+//
+//	minute hour day-of-month month day-of-week
+//
+// Each field is "*", a value, a range "a-b", or a list of these separated by commas,
+// optionally followed by a step "/n". Months and days of the week may also be given
+// by their three letter English names, and Sunday is 0 or 7. As in cron, when both
+// day-of-month and day-of-week are restricted, a time matches if either matches.
+//
+// The descriptors @yearly, @annually, @monthly, @weekly, @daily, @midnight and
+// @hourly are also accepted.
+type CronSchedule struct {
+	expr   string
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	anyDom bool
+	anyDow bool
+}
+
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names []string
+}
+
+var (
+	minuteField = cronField{name: "minute", min: 0, max: 59}
+	hourField   = cronField{name: "hour", min: 0, max: 23}
+	domField    = cronField{name: "day-of-month", min: 1, max: 31}
+	monthField  = cronField{name: "month", min: 1, max: 12, names: []string{
+		"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec",
+	}}
+	dowField = cronField{name: "day-of-week", min: 0, max: 7, names: []string{
+		"sun", "mon", "tue", "wed", "thu", "fri", "sat",
+	}}
+)
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses a five field cron expression.
+func ParseCron(expr string) (*CronSchedule, error) {
+	spec := strings.TrimSpace(expr)
+
+	if d, ok := cronDescriptors[strings.ToLower(spec)]; ok {
+		spec = d
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields, has %d", expr, len(fields))
+	}
+
+	c := &CronSchedule{expr: expr}
+
+	var err error
+
+	if c.minute, err = minuteField.parse(fields[0]); err != nil {
+		return nil, fmt.Errorf("cron expression %q: %w", expr, err)
+	}
+
+	if c.hour, err = hourField.parse(fields[1]); err != nil {
+		return nil, fmt.Errorf("cron expression %q: %w", expr, err)
+	}
+
+	if c.dom, err = domField.parse(fields[2]); err != nil {
+		return nil, fmt.Errorf("cron expression %q: %w", expr, err)
+	}
+
+	if c.month, err = monthField.parse(fields[3]); err != nil {
+		return nil, fmt.Errorf("cron expression %q: %w", expr, err)
+	}
+
+	if c.dow, err = dowField.parse(fields[4]); err != nil {
+		return nil, fmt.Errorf("cron expression %q: %w", expr, err)
+	}
+
+	// Sunday can be written as 0 or 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+
+	c.anyDom = strings.HasPrefix(fields[2], "*")
+	c.anyDow = strings.HasPrefix(fields[4], "*")
+
+	return c, nil
+}
+
+// MustParseCron is like ParseCron but panics if the expression is invalid.
+func MustParseCron(expr string) *CronSchedule {
+	c, err := ParseCron(expr)
+	if err != nil {
+		panic(err)
+	}
+
+	return c
+}
+
+// String returns the expression the schedule was parsed from.
+func (c *CronSchedule) String() string {
+	return c.expr
+}
+
+// Next returns the first time after t that matches the schedule, in the location of t.
+// It returns the zero time if no time matches within the next five years, which can
+// only happen for expressions such as "0 0 30 2 *".
+func (c *CronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if !has(c.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !c.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !has(c.hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !has(c.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (c *CronSchedule) matchesDay(t time.Time) bool {
+	dom := has(c.dom, t.Day())
+	dow := has(c.dow, int(t.Weekday()))
+
+	switch {
+	case c.anyDom && c.anyDow:
+		return true
+	case c.anyDom:
+		return dow
+	case c.anyDow:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+func has(set uint64, v int) bool {
+	return set&(1<<uint(v)) != 0
+}
+
+// parse returns a bit set of the values matched by the field.
+func (f cronField) parse(s string) (uint64, error) {
+	var set uint64
+
+	for _, part := range strings.Split(s, ",") {
+		bits, err := f.parsePart(part)
+		if err != nil {
+			return 0, err
+		}
+
+		set |= bits
+	}
+
+	return set, nil
+}
+
+func (f cronField) parsePart(part string) (uint64, error) {
+	rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+	step := 1
+
+	if hasStep {
+		n, err := strconv.Atoi(stepPart)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid step %q in %s field", stepPart, f.name)
+		}
+
+		step = n
+	}
+
+	var lo, hi int
+
+	switch {
+	case rangePart == "*":
+		lo, hi = f.min, f.max
+
+	case strings.Contains(rangePart, "-"):
+		from, to, _ := strings.Cut(rangePart, "-")
+
+		var err error
+
+		if lo, err = f.value(from); err != nil {
+			return 0, err
+		}
+
+		if hi, err = f.value(to); err != nil {
+			return 0, err
+		}
+
+		if lo > hi {
+			return 0, fmt.Errorf("invalid range %q in %s field", rangePart, f.name)
+		}
+
+	default:
+		v, err := f.value(rangePart)
+		if err != nil {
+			return 0, err
+		}
+
+		lo, hi = v, v
+
+		// "5/15" means every 15 starting at 5
+		if hasStep {
+			hi = f.max
+		}
+	}
+
+	var set uint64
+
+	for v := lo; v <= hi; v += step {
+		set |= 1 << uint(v)
+	}
+
+	return set, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	// Names start at the minimum value: months at 1 and weekdays at 0
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return i + f.min, nil
+		}
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q in %s field", s, f.name)
+	}
+
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("value %d out of range [%d-%d] in %s field", v, f.min, f.max, f.name)
+	}
+
+	return v, nil
+}
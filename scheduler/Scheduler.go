@@ -0,0 +1,324 @@
+// Package scheduler runs periodic jobs on fixed intervals or cron schedules.
+// A Scheduler implements servicemanager.Service so that its jobs start and stop
+// together with the other services of a process.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ordishs/go-utils"
+	"github.com/ordishs/go-utils/servicemanager"
+	"github.com/ordishs/go-utils/stat"
+)
+
+// JobFunc is the work done by a job. The context is cancelled when the scheduler stops.
+type JobFunc func(ctx context.Context) error
+
+// Schedule returns the time at which a job next runs after t.
+// A zero time means the job does not run again.
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// Every returns a Schedule that runs a job at a fixed interval. The interval is
+// measured from the end of the previous run.
+func Every(interval time.Duration) Schedule {
+	return intervalSchedule(interval)
+}
+
+type intervalSchedule time.Duration
+
+func (i intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(i))
+}
+
+// JobStatus describes the runs of a job.
+type JobStatus struct {
+	Name         string
+	Runs         int
+	Failures     int
+	LastRun      time.Time
+	LastDuration time.Duration
+	LastError    error
+	NextRun      time.Time
+}
+
+type job struct {
+	name     string
+	schedule Schedule
+	fn       JobFunc
+	jitter   time.Duration
+	status   JobStatus
+}
+
+// JobOption configures a job.
+type JobOption func(j *job)
+
+// WithJitter delays every run by a random duration in [0, max) to avoid many
+// processes running the same job at the same moment.
+func WithJitter(max time.Duration) JobOption {
+	return func(j *job) {
+		j.jitter = max
+	}
+}
+
+// Option configures a Scheduler.
+type Option func(s *Scheduler)
+
+// WithLogger sets the logger used to report failed runs. The default logs to
+// slog.Default(). If logger is nil, nothing is logged.
+func WithLogger(logger utils.Logger) Option {
+	return func(s *Scheduler) {
+		if logger == nil {
+			logger = utils.NopLogger{}
+		}
+
+		s.logger = logger
+	}
+}
+
+// WithClock sets the clock used to schedule runs. It is intended for tests.
+func WithClock(clock servicemanager.Clock) Option {
+	return func(s *Scheduler) {
+		s.clock = clock
+	}
+}
+
+// WithStats records the duration of every run in stats, under the name of the job
+// for successful runs and under "<name> (failed)" for runs that returned an error.
+// By default a new AtomicStats is used, which is returned by Stats.
+func WithStats(stats *stat.AtomicStats) Option {
+	return func(s *Scheduler) {
+		s.stats = stats
+	}
+}
+
+// Scheduler runs jobs on their schedules. Runs of the same job never overlap: if a
+// run takes longer than the interval, the next run is scheduled after it completes.
+type Scheduler struct {
+	mu      sync.Mutex
+	jobs    []*job
+	logger  utils.Logger
+	clock   servicemanager.Clock
+	stats   *stat.AtomicStats
+	started bool
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+var _ servicemanager.Service = (*Scheduler)(nil)
+
+// New creates a Scheduler without jobs.
+func New(opts ...Option) *Scheduler {
+	s := &Scheduler{
+		logger: utils.NewSlogLogger(slog.Default().With("component", "scheduler")),
+		clock:  servicemanager.SystemClock(),
+		stats:  stat.NewAtomicStats(),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Add registers a job that runs on schedule. Jobs must be added before Start is called.
+func (s *Scheduler) Add(name string, schedule Schedule, fn JobFunc, opts ...JobOption) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return fmt.Errorf("job %q cannot be added after the scheduler has started", name)
+	}
+
+	for _, j := range s.jobs {
+		if j.name == name {
+			return fmt.Errorf("job %q is already registered", name)
+		}
+	}
+
+	j := &job{
+		name:     name,
+		schedule: schedule,
+		fn:       fn,
+		status:   JobStatus{Name: name},
+	}
+
+	for _, opt := range opts {
+		opt(j)
+	}
+
+	s.jobs = append(s.jobs, j)
+
+	return nil
+}
+
+// AddInterval registers a job that runs every interval.
+func (s *Scheduler) AddInterval(name string, interval time.Duration, fn JobFunc, opts ...JobOption) error {
+	if interval <= 0 {
+		return fmt.Errorf("job %q must have a positive interval", name)
+	}
+
+	return s.Add(name, Every(interval), fn, opts...)
+}
+
+// AddCron registers a job that runs on a cron schedule, see CronSchedule.
+func (s *Scheduler) AddCron(name string, expr string, fn JobFunc, opts ...JobOption) error {
+	schedule, err := ParseCron(expr)
+	if err != nil {
+		return err
+	}
+
+	return s.Add(name, schedule, fn, opts...)
+}
+
+// Stats returns the run durations of all jobs.
+func (s *Scheduler) Stats() *stat.AtomicStats {
+	return s.stats
+}
+
+// Status returns the status of every job in the order they were added.
+func (s *Scheduler) Status() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := make([]JobStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		status = append(status, j.status)
+	}
+
+	return status
+}
+
+func (s *Scheduler) Init(ctx context.Context) error {
+	return nil
+}
+
+// Start runs the jobs until ctx is cancelled or Stop is called, and waits for
+// runs in progress to return.
+func (s *Scheduler) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+
+	s.mu.Lock()
+	s.started = true
+	s.cancel = cancel
+	jobs := append([]*job{}, s.jobs...)
+	s.mu.Unlock()
+
+	for _, j := range jobs {
+		s.wg.Add(1)
+
+		go func(j *job) {
+			defer s.wg.Done()
+			s.runJob(ctx, j)
+		}(j)
+	}
+
+	<-ctx.Done()
+
+	s.wg.Wait()
+
+	return nil
+}
+
+// Stop cancels the jobs and waits for runs in progress to return or for ctx to be done.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Scheduler) runJob(ctx context.Context, j *job) {
+	for {
+		now := s.clock.Now()
+
+		next := j.schedule.Next(now)
+		if next.IsZero() {
+			return
+		}
+
+		s.mu.Lock()
+		j.status.NextRun = next
+		s.mu.Unlock()
+
+		wait := next.Sub(now)
+
+		if j.jitter > 0 {
+			wait += time.Duration(rand.Int63n(int64(j.jitter)))
+		}
+
+		timer := s.clock.NewTimer(wait)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+
+		s.run(ctx, j)
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, j *job) {
+	start := s.clock.Now()
+
+	err := safeRun(ctx, j.fn)
+
+	duration := s.clock.Now().Sub(start)
+
+	if err != nil {
+		s.logger.Errorf("[%s] Job failed: %v", j.name, err)
+		s.stats.AddDuration(j.name+" (failed)", duration)
+	} else {
+		s.stats.AddDuration(j.name, duration)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j.status.Runs++
+	j.status.LastRun = start
+	j.status.LastDuration = duration
+	j.status.LastError = err
+
+	if err != nil {
+		j.status.Failures++
+	}
+}
+
+// safeRun calls fn and turns a panic into an error so that one job cannot bring
+// down the scheduler.
+func safeRun(ctx context.Context, fn JobFunc) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return fn(ctx)
+}
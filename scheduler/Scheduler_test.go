@@ -0,0 +1,194 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ordishs/go-utils"
+	"github.com/ordishs/go-utils/servicemanager/smtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedulerRunsJobs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	clock := smtest.NewFakeClock(time.Date(2024, time.January, 10, 10, 30, 0, 0, time.UTC))
+	s := New(WithClock(clock), WithLogger(utils.NopLogger{}))
+
+	var ok, failed atomic.Int32
+
+	runs := make(chan string, 10)
+
+	require.NoError(t, s.AddInterval("cleanup", time.Minute, func(ctx context.Context) error {
+		ok.Add(1)
+		runs <- "cleanup"
+		return nil
+	}))
+
+	require.NoError(t, s.AddCron("prune", "*/5 * * * *", func(ctx context.Context) error {
+		failed.Add(1)
+		runs <- "prune"
+		return errors.New("boom")
+	}))
+
+	assert.Error(t, s.AddInterval("cleanup", time.Minute, nil))
+	assert.Error(t, s.AddCron("bad", "* *", nil))
+
+	done := make(chan error)
+
+	go func() {
+		done <- s.Start(ctx)
+	}()
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, clock.WaitForTimers(ctx, 2))
+		clock.Advance(time.Minute)
+
+		<-runs
+
+		if i == 4 {
+			<-runs
+		}
+	}
+
+	require.NoError(t, s.Stop(ctx))
+	require.NoError(t, <-done)
+
+	assert.Equal(t, int32(5), ok.Load())
+	assert.Equal(t, int32(1), failed.Load())
+
+	status := s.Status()
+	require.Len(t, status, 2)
+
+	assert.Equal(t, "cleanup", status[0].Name)
+	assert.Equal(t, 5, status[0].Runs)
+	assert.NoError(t, status[0].LastError)
+
+	assert.Equal(t, 1, status[1].Runs)
+	assert.Equal(t, 1, status[1].Failures)
+	assert.EqualError(t, status[1].LastError, "boom")
+
+	stats := s.Stats().GetMap()
+	assert.Equal(t, int32(5), stats["cleanup"].GetCount())
+	assert.Equal(t, int32(1), stats["prune (failed)"].GetCount())
+
+	assert.Error(t, s.AddInterval("late", time.Minute, nil))
+}
+
+func TestSchedulerNoOverlap(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	clock := smtest.NewFakeClock(time.Unix(0, 0))
+	s := New(WithClock(clock), WithLogger(utils.NopLogger{}))
+
+	var running, maxRunning, runs atomic.Int32
+
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+
+	require.NoError(t, s.AddInterval("slow", time.Second, func(ctx context.Context) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+
+		if n > maxRunning.Load() {
+			maxRunning.Store(n)
+		}
+
+		runs.Add(1)
+		started <- struct{}{}
+		<-release
+
+		return nil
+	}, WithJitter(time.Millisecond)))
+
+	done := make(chan error)
+
+	go func() {
+		done <- s.Start(ctx)
+	}()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, clock.WaitForTimers(ctx, 1))
+		clock.Advance(time.Second + time.Millisecond)
+		<-started
+
+		// The next run is only scheduled once this one returns, however long it takes
+		clock.Advance(time.Minute)
+		assert.Equal(t, 0, clock.Timers())
+
+		release <- struct{}{}
+	}
+
+	require.NoError(t, s.Stop(ctx))
+	require.NoError(t, <-done)
+
+	assert.Equal(t, int32(3), runs.Load())
+	assert.Equal(t, int32(1), maxRunning.Load())
+}
+
+func TestSchedulerNilLogger(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	clock := smtest.NewFakeClock(time.Unix(0, 0))
+	s := New(WithClock(clock), WithLogger(nil))
+
+	ran := make(chan struct{})
+
+	require.NoError(t, s.AddInterval("fails", time.Second, func(ctx context.Context) error {
+		defer close(ran)
+		return errors.New("boom")
+	}))
+
+	go func() {
+		_ = s.Start(ctx)
+	}()
+
+	require.NoError(t, clock.WaitForTimers(ctx, 1))
+	clock.Advance(time.Second)
+	<-ran
+
+	// Reporting the failure must not panic
+	require.NoError(t, clock.WaitForTimers(ctx, 1))
+	assert.Equal(t, 1, s.Status()[0].Failures)
+
+	require.NoError(t, s.Stop(ctx))
+}
+
+func TestSchedulerRecoversPanics(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	clock := smtest.NewFakeClock(time.Unix(0, 0))
+	s := New(WithClock(clock), WithLogger(utils.NopLogger{}))
+
+	ran := make(chan struct{})
+
+	require.NoError(t, s.AddInterval("panics", time.Second, func(ctx context.Context) error {
+		defer close(ran)
+		panic("oops")
+	}))
+
+	go func() {
+		_ = s.Start(ctx)
+	}()
+
+	require.NoError(t, clock.WaitForTimers(ctx, 1))
+	clock.Advance(time.Second)
+	<-ran
+
+	// The job is scheduled again after the panic
+	require.NoError(t, clock.WaitForTimers(ctx, 1))
+
+	status := s.Status()
+	assert.Equal(t, 1, status[0].Failures)
+	assert.EqualError(t, status[0].LastError, "panic: oops")
+
+	require.NoError(t, s.Stop(ctx))
+}
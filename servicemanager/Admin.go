@@ -0,0 +1,234 @@
+package servicemanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// AdminStatus is the response of the admin endpoints.
+type AdminStatus struct {
+	Services []ServiceStatus `json:"services"`
+}
+
+// StatusHandler returns an http.Handler that responds with the status of all
+// services as JSON.
+func (sm *ServiceManager) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(AdminStatus{Services: sm.Status()}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// ---------------------------------------------------------------------
+// The admin gRPC service is described by hand so that no generated code is needed.
+// It is equivalent to:
+//
+//	service Admin {
+//	  rpc GetStatus(google.protobuf.Empty) returns (google.protobuf.Struct);
+//	}
+//
+// where the returned Struct has the same shape as the JSON returned by StatusHandler.
+
+const adminGetStatusMethod = "/servicemanager.Admin/GetStatus"
+
+// AdminServer is the server API of the admin gRPC service.
+type AdminServer interface {
+	GetStatus(ctx context.Context, req *emptypb.Empty) (*structpb.Struct, error)
+}
+
+type adminServer struct {
+	sm *ServiceManager
+}
+
+func (a *adminServer) GetStatus(_ context.Context, _ *emptypb.Empty) (*structpb.Struct, error) {
+	b, err := json.Marshal(AdminStatus{Services: a.sm.Status()})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &structpb.Struct{}
+	if err := protojson.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func adminGetStatusHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+
+	if interceptor == nil {
+		return srv.(AdminServer).GetStatus(ctx, in)
+	}
+
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: adminGetStatusMethod,
+	}
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetStatus(ctx, req.(*emptypb.Empty))
+	}
+
+	return interceptor(ctx, in, info, handler)
+}
+
+var adminServiceDesc = grpc.ServiceDesc{
+	ServiceName: "servicemanager.Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetStatus",
+			Handler:    adminGetStatusHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+// RegisterAdminServer registers the admin gRPC service for sm on srv.
+func (sm *ServiceManager) RegisterAdminServer(srv grpc.ServiceRegistrar) {
+	srv.RegisterService(&adminServiceDesc, &adminServer{sm: sm})
+}
+
+// GetAdminStatus calls the admin gRPC service over conn and returns the status
+// of the services of the remote ServiceManager.
+func GetAdminStatus(ctx context.Context, conn grpc.ClientConnInterface) ([]ServiceStatus, error) {
+	out := &structpb.Struct{}
+
+	if err := conn.Invoke(ctx, adminGetStatusMethod, &emptypb.Empty{}, out); err != nil {
+		return nil, err
+	}
+
+	b, err := protojson.Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+
+	var status AdminStatus
+	if err := json.Unmarshal(b, &status); err != nil {
+		return nil, err
+	}
+
+	return status.Services, nil
+}
+
+// ---------------------------------------------------------------------
+
+// AdminHTTPService is a Service that serves the JSON status of a ServiceManager
+// over HTTP at /status. It can itself be added to the ServiceManager.
+type AdminHTTPService struct {
+	address string
+	handler http.Handler
+
+	mu       sync.Mutex
+	server   *http.Server
+	listener net.Listener
+}
+
+// NewAdminHTTPService creates an AdminHTTPService that listens on address.
+func NewAdminHTTPService(address string, sm *ServiceManager) *AdminHTTPService {
+	mux := http.NewServeMux()
+	mux.Handle("/status", sm.StatusHandler())
+
+	return &AdminHTTPService{
+		address: address,
+		handler: mux,
+	}
+}
+
+// Addr returns the address the service is listening on, or nil if it is not running.
+func (a *AdminHTTPService) Addr() net.Addr {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.listener == nil {
+		return nil
+	}
+
+	return a.listener.Addr()
+}
+
+func (a *AdminHTTPService) Init(ctx context.Context) error {
+	return nil
+}
+
+func (a *AdminHTTPService) SignalsReady() bool {
+	return true
+}
+
+// Start serves until ctx is cancelled or Stop is called. A new http.Server is
+// created for every call, so that the service can be restarted.
+func (a *AdminHTTPService) Start(ctx context.Context) error {
+	lis, err := net.Listen("tcp", a.address)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Handler:           a.handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	a.mu.Lock()
+	a.server, a.listener = server, lis
+	a.mu.Unlock()
+
+	defer func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+
+		if a.server == server {
+			a.server, a.listener = nil, nil
+		}
+	}()
+
+	SignalReady(ctx)
+
+	stopped := make(chan struct{})
+	defer close(stopped)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), defaultStopTimeout)
+			defer cancel()
+
+			_ = server.Shutdown(shutdownCtx)
+		case <-stopped:
+		}
+	}()
+
+	if err := server.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+func (a *AdminHTTPService) Stop(ctx context.Context) error {
+	a.mu.Lock()
+	server := a.server
+	a.mu.Unlock()
+
+	if server == nil {
+		return nil
+	}
+
+	return server.Shutdown(ctx)
+}
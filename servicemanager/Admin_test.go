@@ -0,0 +1,161 @@
+package servicemanager
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ordishs/go-utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestStatus(t *testing.T) {
+	sm := NewServiceManager(WithLogger(utils.NopLogger{}))
+
+	r := &recorder{}
+
+	require.NoError(t, sm.AddService("db", &testService{name: "db", recorder: r}))
+	require.NoError(t, sm.AddService("api", &testService{name: "api", recorder: r}, DependsOn("db"), Critical(false)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error)
+
+	go func() {
+		done <- sm.StartAllAndWait(ctx)
+	}()
+
+	require.NoError(t, sm.WaitReady(context.Background()))
+
+	status := sm.Status()
+	require.Len(t, status, 2)
+
+	assert.Equal(t, "db", status[0].Name)
+	assert.Equal(t, StateReady, status[0].State)
+	assert.True(t, status[0].Critical)
+	assert.WithinDuration(t, time.Now(), status[0].StartTime, time.Second)
+
+	assert.Equal(t, "api", status[1].Name)
+	assert.Equal(t, []string{"db"}, status[1].DependsOn)
+	assert.False(t, status[1].Critical)
+
+	// The returned dependencies are a copy
+	status[1].DependsOn[0] = "changed"
+	assert.Equal(t, []string{"db"}, sm.Status()[1].DependsOn)
+
+	// HTTP
+	rec := httptest.NewRecorder()
+	sm.StatusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var adminStatus AdminStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &adminStatus))
+	require.Len(t, adminStatus.Services, 2)
+	assert.Equal(t, StateReady, adminStatus.Services[1].State)
+
+	// gRPC
+	h, err := utils.NewBufconnHarness(context.Background(), &utils.ConnectionOptions{}, &utils.ConnectionOptions{}, func(srv *grpc.Server) {
+		sm.RegisterAdminServer(srv)
+	})
+	require.NoError(t, err)
+
+	remote, err := GetAdminStatus(context.Background(), h.Conn)
+	require.NoError(t, err)
+	require.Len(t, remote, 2)
+	assert.Equal(t, "db", remote[0].Name)
+	assert.Equal(t, StateReady, remote[0].State)
+
+	require.NoError(t, h.Close())
+
+	cancel()
+	require.NoError(t, <-done)
+
+	assert.Equal(t, StateStopped, sm.Status()[0].State)
+}
+
+func getStatus(t *testing.T, addr net.Addr) AdminStatus {
+	t.Helper()
+
+	res, err := http.Get("http://" + addr.String() + "/status")
+	require.NoError(t, err)
+
+	defer res.Body.Close()
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	var status AdminStatus
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&status))
+
+	return status
+}
+
+func TestAdminHTTPService(t *testing.T) {
+	sm := NewServiceManager(WithLogger(utils.NopLogger{}))
+
+	admin := NewAdminHTTPService("127.0.0.1:0", sm)
+	require.NoError(t, sm.AddService("admin", admin))
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- sm.StartAllAndWait(ctx)
+	}()
+
+	require.NoError(t, sm.WaitReady(context.Background()))
+
+	status := getStatus(t, admin.Addr())
+	require.Len(t, status.Services, 1)
+	assert.Equal(t, StateReady, status.Services[0].State)
+
+	// Cancelling the context must stop the server so that shutdown completes
+	cancel()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("StartAllAndWait did not return after the context was cancelled")
+	}
+
+	assert.Nil(t, admin.Addr())
+	assert.Equal(t, StateStopped, sm.Status()[0].State)
+}
+
+func TestAdminHTTPServiceRestart(t *testing.T) {
+	sm := NewServiceManager(WithLogger(utils.NopLogger{}))
+	admin := NewAdminHTTPService("127.0.0.1:0", sm)
+
+	// The service can be started again after it has been stopped
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		done := make(chan error, 1)
+
+		go func() {
+			done <- admin.Start(ctx)
+		}()
+
+		require.Eventually(t, func() bool {
+			return admin.Addr() != nil
+		}, time.Second, time.Millisecond)
+
+		getStatus(t, admin.Addr())
+
+		if i == 0 {
+			cancel()
+		} else {
+			require.NoError(t, admin.Stop(context.Background()))
+		}
+
+		require.NoError(t, <-done)
+		cancel()
+	}
+}
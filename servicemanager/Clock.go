@@ -0,0 +1,131 @@
+package servicemanager
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// Clock is the source of time used by the ServiceManager for timestamps, timeouts and
+// restart backoffs. It can be replaced with WithClock to test time-dependent behaviour
+// without waiting.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer delivers the time on C once its duration has elapsed, like time.Timer.
+// Stop releases a timer that is no longer needed.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// SystemClock returns the Clock that uses the time package. It is the default.
+func SystemClock() Clock {
+	return realClock{}
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// clockUser is implemented by services that measure time, such as LeaderService,
+// so that the ServiceManager can give them its Clock.
+type clockUser interface {
+	setClock(clock Clock)
+}
+
+// withClockTimeout is like context.WithTimeout, but the timeout is measured with clock.
+// The returned context reports its deadline and returns context.DeadlineExceeded from
+// Err once the timeout has expired, whichever clock is used.
+func withClockTimeout(parent context.Context, clock Clock, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := clock.(realClock); ok {
+		return context.WithTimeout(parent, timeout)
+	}
+
+	ctx, cancel := context.WithCancelCause(parent)
+	timer := clock.NewTimer(timeout)
+
+	go func() {
+		select {
+		case <-timer.C():
+			cancel(context.DeadlineExceeded)
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}()
+
+	deadlineCtx := &clockDeadlineContext{
+		Context:  ctx,
+		deadline: clock.Now().Add(timeout),
+	}
+
+	// The timer is stopped before the context is cancelled, so that it is no longer
+	// pending once the caller is done with the context.
+	return deadlineCtx, func() {
+		timer.Stop()
+		cancel(context.Canceled)
+	}
+}
+
+type clockDeadlineContext struct {
+	context.Context
+	deadline time.Time
+}
+
+func (c *clockDeadlineContext) Deadline() (time.Time, bool) {
+	if d, ok := c.Context.Deadline(); ok && d.Before(c.deadline) {
+		return d, true
+	}
+
+	return c.deadline, true
+}
+
+func (c *clockDeadlineContext) Err() error {
+	err := c.Context.Err()
+	if err != nil && errors.Is(context.Cause(c.Context), context.DeadlineExceeded) {
+		return context.DeadlineExceeded
+	}
+
+	return err
+}
+
+// SignalNotifier relays OS signals to the ServiceManager. The default uses the
+// os/signal package. It can be replaced with WithSignalNotifier to deliver signals
+// in tests without sending them to the process.
+type SignalNotifier interface {
+	Notify(c chan<- os.Signal, sigs ...os.Signal)
+	Stop(c chan<- os.Signal)
+}
+
+type osSignalNotifier struct{}
+
+func (osSignalNotifier) Notify(c chan<- os.Signal, sigs ...os.Signal) {
+	signal.Notify(c, sigs...)
+}
+
+func (osSignalNotifier) Stop(c chan<- os.Signal) {
+	signal.Stop(c)
+}
@@ -0,0 +1,102 @@
+package servicemanager
+
+import "fmt"
+
+// findCycle returns the names of the services that form a dependency cycle, or nil.
+// Dependencies that are not registered yet are ignored.
+func (sm *ServiceManager) findCycle() []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	marks := make(map[string]int, len(sm.services))
+
+	var path []string
+
+	var visit func(s *serviceWrapper) []string
+	visit = func(s *serviceWrapper) []string {
+		switch marks[s.name] {
+		case visiting:
+			for i, name := range path {
+				if name == s.name {
+					return append(append([]string{}, path[i:]...), s.name)
+				}
+			}
+		case visited:
+			return nil
+		}
+
+		marks[s.name] = visiting
+		path = append(path, s.name)
+
+		for _, dep := range s.dependsOn {
+			if d := sm.find(dep); d != nil {
+				if cycle := visit(d); cycle != nil {
+					return cycle
+				}
+			}
+		}
+
+		path = path[:len(path)-1]
+		marks[s.name] = visited
+
+		return nil
+	}
+
+	for _, s := range sm.services {
+		if cycle := visit(s); cycle != nil {
+			return cycle
+		}
+	}
+
+	return nil
+}
+
+// sortServices returns the services ordered so that every service comes after its dependencies.
+// Services without an ordering constraint keep the order in which they were added.
+func (sm *ServiceManager) sortServices() ([]*serviceWrapper, error) {
+	for _, s := range sm.services {
+		for _, dep := range s.dependsOn {
+			if sm.find(dep) == nil {
+				return nil, fmt.Errorf("service %q depends on unknown service %q", s.name, dep)
+			}
+		}
+	}
+
+	sorted := make([]*serviceWrapper, 0, len(sm.services))
+	placed := make(map[string]bool, len(sm.services))
+
+	for len(sorted) < len(sm.services) {
+		progress := false
+
+		for _, s := range sm.services {
+			if placed[s.name] {
+				continue
+			}
+
+			ok := true
+
+			for _, dep := range s.dependsOn {
+				if !placed[dep] {
+					ok = false
+					break
+				}
+			}
+
+			if ok {
+				sorted = append(sorted, s)
+				placed[s.name] = true
+				progress = true
+			}
+		}
+
+		if !progress {
+			// Cannot happen as cycles are rejected by AddService
+			return nil, fmt.Errorf("dependency cycle detected: %v", sm.findCycle())
+		}
+	}
+
+	return sorted, nil
+}
@@ -0,0 +1,99 @@
+package servicemanager
+
+import (
+	"slices"
+	"time"
+)
+
+// Event describes a lifecycle transition of a service. The states map to the
+// lifecycle as follows:
+//
+//	StateInitializing  before Init is called
+//	StateInitialized   after Init has returned successfully
+//	StateStarting      Start has been called
+//	StateReady         the service is ready (see ReadySignaller)
+//	StateRestarting    Start returned and the service will be restarted
+//	StateStopping      before Stop is called
+//	StateStopped       after Stop has returned successfully, or Start returned
+//	                   without an error and the service is not restarted
+//	StateFailed        Init, Start or Stop returned an error
+type Event struct {
+	Service string
+	From    ServiceState
+	To      ServiceState
+	Time    time.Time
+	Err     error
+}
+
+type hook struct {
+	fn     func(e Event)
+	states []ServiceState
+}
+
+// AddHook registers a function that is called for every transition to one of the
+// given states, or for every transition if no states are given. Hooks are called
+// synchronously from the goroutine that changes the state, so they must not block.
+// A hook may call AddHook and Subscribe.
+func (sm *ServiceManager) AddHook(fn func(e Event), states ...ServiceState) {
+	sm.eventsMu.Lock()
+	defer sm.eventsMu.Unlock()
+
+	sm.hooks = append(sm.hooks, hook{fn: fn, states: states})
+}
+
+// Subscribe returns a channel that receives every lifecycle event, and a function
+// that unsubscribes and closes the channel. Events are dropped when the channel
+// buffer is full, so that a slow subscriber cannot block the ServiceManager.
+func (sm *ServiceManager) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+
+	sm.eventsMu.Lock()
+	sm.subscribers[ch] = struct{}{}
+	sm.eventsMu.Unlock()
+
+	unsubscribe := func() {
+		sm.eventsMu.Lock()
+		defer sm.eventsMu.Unlock()
+
+		if _, ok := sm.subscribers[ch]; ok {
+			delete(sm.subscribers, ch)
+			close(ch)
+		}
+	}
+
+	return ch, unsubscribe
+}
+
+func (sm *ServiceManager) emit(e Event) {
+	sm.eventsMu.RLock()
+	hooks := slices.Clone(sm.hooks)
+	sm.eventsMu.RUnlock()
+
+	for _, h := range hooks {
+		if len(h.states) == 0 || containsState(h.states, e.To) {
+			h.fn(e)
+		}
+	}
+
+	// The sends do not block, and holding the lock stops unsubscribe from closing
+	// a channel while an event is being sent to it.
+	sm.eventsMu.RLock()
+	defer sm.eventsMu.RUnlock()
+
+	for ch := range sm.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+func containsState(states []ServiceState, state ServiceState) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,140 @@
+package servicemanager
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/ordishs/go-utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvents(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	sm := NewServiceManager(WithLogger(utils.NopLogger{}), WithPrometheus(registry))
+
+	// The collectors registered by sm are reused
+	metrics, err := newPrometheusMetrics(registry)
+	require.NoError(t, err)
+
+	r := &recorder{}
+	errFailed := errors.New("failed")
+
+	var mu sync.Mutex
+	var failures []Event
+
+	sm.AddHook(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		failures = append(failures, e)
+	}, StateFailed)
+
+	events, unsubscribe := sm.Subscribe(100)
+
+	require.NoError(t, sm.AddService("events-db", &testService{name: "events-db", recorder: r}))
+	require.NoError(t, sm.AddService("events-api", &testService{name: "events-api", recorder: r, startErr: errFailed}, DependsOn("events-db")))
+
+	err = sm.StartAllAndWait(context.Background())
+	assert.ErrorIs(t, err, errFailed)
+
+	unsubscribe()
+
+	var transitions []string
+
+	for e := range events {
+		if e.Service == "events-db" {
+			transitions = append(transitions, e.From.String()+" -> "+e.To.String())
+		}
+	}
+
+	assert.Equal(t, []string{
+		"registered -> initializing",
+		"initializing -> initialized",
+		"initialized -> starting",
+		"starting -> ready",
+		"ready -> stopping",
+		"stopping -> stopped",
+	}, transitions)
+
+	mu.Lock()
+	require.Len(t, failures, 2) // Start failed, and the service is still failed after Stop
+	assert.Equal(t, "events-api", failures[0].Service)
+	assert.ErrorIs(t, failures[0].Err, errFailed)
+	mu.Unlock()
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.state.WithLabelValues("events-db", "stopped")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.state.WithLabelValues("events-db", "ready")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.transitions.WithLabelValues("events-api", "starting")))
+}
+
+func TestPrometheusSharedRegisterer(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	// A second manager must not panic on the already registered collectors
+	sm1 := NewServiceManager(WithLogger(utils.NopLogger{}), WithPrometheus(registry))
+	sm2 := NewServiceManager(WithLogger(utils.NopLogger{}), WithPrometheus(registry))
+
+	r := &recorder{}
+	errFailed := errors.New("failed")
+
+	require.NoError(t, sm1.AddService("shared-1", &testService{name: "shared-1", recorder: r, startErr: errFailed}))
+	require.NoError(t, sm2.AddService("shared-2", &testService{name: "shared-2", recorder: r, startErr: errFailed}))
+
+	assert.ErrorIs(t, sm1.StartAllAndWait(context.Background()), errFailed)
+	assert.ErrorIs(t, sm2.StartAllAndWait(context.Background()), errFailed)
+
+	metrics, err := newPrometheusMetrics(registry)
+	require.NoError(t, err)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.transitions.WithLabelValues("shared-1", "starting")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.transitions.WithLabelValues("shared-2", "starting")))
+}
+
+func TestHookCanRegisterHooks(t *testing.T) {
+	sm := NewServiceManager(WithLogger(utils.NopLogger{}))
+
+	var (
+		mu      sync.Mutex
+		added   bool
+		started []string
+		events  <-chan Event
+	)
+
+	sm.AddHook(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if added {
+			return
+		}
+
+		added = true
+
+		// Registering from a hook must not deadlock
+		sm.AddHook(func(e Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			started = append(started, e.Service)
+		}, StateStarting)
+
+		events, _ = sm.Subscribe(100)
+	}, StateInitializing)
+
+	r := &recorder{}
+	errFailed := errors.New("failed")
+
+	require.NoError(t, sm.AddService("hooks", &testService{name: "hooks", recorder: r, startErr: errFailed}))
+
+	assert.ErrorIs(t, sm.StartAllAndWait(context.Background()), errFailed)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.True(t, added)
+	assert.NotEmpty(t, events)
+	assert.Equal(t, []string{"hooks"}, started)
+}
@@ -0,0 +1,187 @@
+package servicemanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// InitError is returned by StartAllAndWait when one or more services fail to initialise.
+type InitError struct {
+	Errors map[string]error // The error returned by each service that failed to initialise
+}
+
+func (e *InitError) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	msgs := make([]string, 0, len(names))
+	for _, name := range names {
+		msgs = append(msgs, fmt.Sprintf("[%s] %v", name, e.Errors[name]))
+	}
+
+	return "failed to initialise services: " + strings.Join(msgs, "; ")
+}
+
+func (e *InitError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// initServices initialises the given services, which must be sorted in dependency order.
+// Every service whose dependencies initialised successfully is initialised, so that all
+// failures are reported together. It returns the services that were initialised.
+func (sm *ServiceManager) initServices(ctx context.Context, services []*serviceWrapper) ([]*serviceWrapper, error) {
+	var (
+		mu          sync.Mutex
+		initialised = make(map[string]bool, len(services))
+		errs        = make(map[string]error)
+	)
+
+	initOne := func(s *serviceWrapper) {
+		mu.Lock()
+		for _, dep := range s.dependsOn {
+			if !initialised[dep] {
+				mu.Unlock()
+				s.logger.Warnf("Not initializing service as dependency %s is not initialized", dep)
+				s.clearRunning()
+
+				return
+			}
+		}
+		mu.Unlock()
+
+		if ctx.Err() != nil {
+			s.clearRunning()
+			return
+		}
+
+		err := sm.initService(ctx, s)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if err != nil {
+			errs[s.name] = err
+		} else {
+			initialised[s.name] = true
+		}
+	}
+
+	if sm.parallelInit {
+		initInParallel(services, initOne)
+	} else {
+		for _, s := range services {
+			initOne(s)
+		}
+	}
+
+	var done []*serviceWrapper
+
+	for _, s := range services {
+		if initialised[s.name] {
+			done = append(done, s)
+		}
+	}
+
+	if len(errs) > 0 {
+		return done, &InitError{Errors: errs}
+	}
+
+	if ctx.Err() != nil {
+		return done, ctx.Err()
+	}
+
+	return done, nil
+}
+
+// initInParallel calls init for every service concurrently, waiting for the
+// dependencies of a service to be initialised before initialising it.
+func initInParallel(services []*serviceWrapper, init func(s *serviceWrapper)) {
+	done := make(map[string]chan struct{}, len(services))
+	for _, s := range services {
+		done[s.name] = make(chan struct{})
+	}
+
+	var wg sync.WaitGroup
+
+	for _, service := range services {
+		s := service
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			defer close(done[s.name])
+
+			for _, dep := range s.dependsOn {
+				if ch, ok := done[dep]; ok {
+					<-ch
+				}
+			}
+
+			init(s)
+		}()
+	}
+
+	wg.Wait()
+}
+
+// initService calls Init on the service and waits for it to return or for the init
+// timeout to expire.
+func (sm *ServiceManager) initService(ctx context.Context, s *serviceWrapper) error {
+	timeout := s.initTimeout
+	if timeout == 0 {
+		timeout = sm.initTimeout
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = withClockTimeout(ctx, s.clock, timeout)
+		defer cancel()
+	}
+
+	s.logger.Infof("Initializing service...")
+	s.setState(StateInitializing, nil)
+
+	result := make(chan error, 1)
+
+	go func() {
+		result <- s.instance.Init(ctx)
+	}()
+
+	var err error
+
+	select {
+	case err = <-result:
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("did not initialize within %s", timeout)
+		} else {
+			err = ctx.Err()
+		}
+	}
+
+	if err != nil {
+		s.logger.Errorf("Failed to initialize service: %v", err)
+		s.setState(StateFailed, err)
+		s.clearRunning()
+
+		return err
+	}
+
+	s.setState(StateInitialized, nil)
+
+	return nil
+}
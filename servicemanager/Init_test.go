@@ -0,0 +1,102 @@
+package servicemanager_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ordishs/go-utils"
+	"github.com/ordishs/go-utils/servicemanager"
+	"github.com/ordishs/go-utils/servicemanager/smtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParallelInit(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	clock := smtest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	rec := smtest.NewRecorder()
+	errFailed := errors.New("failed")
+
+	sm := servicemanager.NewServiceManager(servicemanager.WithLogger(utils.NopLogger{}), servicemanager.WithClock(clock), servicemanager.WithParallelInit())
+
+	require.NoError(t, sm.AddService("db", smtest.NewFakeService("db", rec).WithClock(clock).ScriptInit(smtest.Result{Delay: 100 * time.Millisecond})))
+	require.NoError(t, sm.AddService("cache", smtest.NewFakeService("cache", rec).WithClock(clock).ScriptInit(smtest.Result{Delay: 100 * time.Millisecond})))
+	require.NoError(t, sm.AddService("api", smtest.NewFakeService("api", rec).ScriptStart(smtest.Result{Err: errFailed}), servicemanager.DependsOn("db", "cache")))
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- sm.StartAllAndWait(ctx)
+	}()
+
+	// db and cache are initialised concurrently, so both are waiting on the clock at the same time
+	require.NoError(t, clock.WaitForTimers(ctx, 2))
+	assert.ElementsMatch(t, []string{"init db", "init cache"}, rec.Events())
+
+	clock.Advance(100 * time.Millisecond)
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, errFailed)
+	case <-ctx.Done():
+		t.Fatal("StartAllAndWait did not return")
+	}
+
+	smtest.AssertBefore(t, rec, "init db", "init api")
+	smtest.AssertBefore(t, rec, "init cache", "init api")
+}
+
+func TestInitFailures(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	clock := smtest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	rec := smtest.NewRecorder()
+	errDB := errors.New("db failed")
+
+	sm := servicemanager.NewServiceManager(servicemanager.WithLogger(utils.NopLogger{}), servicemanager.WithClock(clock), servicemanager.WithInitTimeout(time.Second))
+
+	require.NoError(t, sm.AddService("config", smtest.NewFakeService("config", rec)))
+	require.NoError(t, sm.AddService("db", smtest.NewFakeService("db", rec).ScriptInit(smtest.Result{Err: errDB})))
+	require.NoError(t, sm.AddService("hung", smtest.NewFakeService("hung", rec).WithClock(clock).ScriptInit(smtest.Result{Delay: time.Hour}), servicemanager.InitTimeout(20*time.Millisecond)))
+	require.NoError(t, sm.AddService("api", smtest.NewFakeService("api", rec), servicemanager.DependsOn("db")))
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- sm.StartAllAndWait(ctx)
+	}()
+
+	// The init timeout and the delay of hung
+	require.NoError(t, rec.WaitFor(ctx, "init hung"))
+	require.NoError(t, clock.WaitForTimers(ctx, 2))
+
+	clock.Advance(20 * time.Millisecond)
+
+	var err error
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		t.Fatal("StartAllAndWait did not return")
+	}
+
+	var initErr *servicemanager.InitError
+	require.ErrorAs(t, err, &initErr)
+
+	assert.Len(t, initErr.Errors, 2)
+	assert.ErrorIs(t, err, errDB)
+	assert.ErrorContains(t, initErr.Errors["hung"], "did not initialize within")
+	assert.Equal(t, "failed to initialise services: [db] db failed; [hung] did not initialize within 20ms", err.Error())
+
+	// Only config was initialised, so only config is stopped and api is never initialised
+	smtest.AssertEvents(t, rec, "init config", "init db", "init hung", "stop config")
+
+	state, err := sm.State("api")
+	require.NoError(t, err)
+	assert.Equal(t, servicemanager.StateRegistered, state)
+}
@@ -0,0 +1,199 @@
+package servicemanager
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// LeaseProvider grants an exclusive lease, so that a service only runs on one
+// replica at a time.
+type LeaseProvider interface {
+	// Acquire blocks until the lease is held or ctx is done.
+	Acquire(ctx context.Context) (Lease, error)
+}
+
+// Lease is a lease held from a LeaseProvider.
+type Lease interface {
+	// Lost returns a channel that is closed when the lease is lost or released.
+	Lost() <-chan struct{}
+	// Release gives up the lease.
+	Release() error
+}
+
+// LeaderService wraps a Service so that its Start method is only called while a
+// lease is held from a LeaseProvider. When the lease is lost the context passed to
+// Start is cancelled and Stop is called, after which the lease is acquired again.
+// For every leadership term after the first, Init is called again before Start.
+//
+// Replicas that are waiting for the lease are considered ready, so that services
+// that depend on a LeaderService are not held up on standby replicas.
+type LeaderService struct {
+	service     Service
+	provider    LeaseProvider
+	stopTimeout time.Duration
+	clock       Clock
+
+	mu     sync.Mutex
+	lease  Lease
+	active bool // Start has been called on the service and Stop has not
+}
+
+// LeaderOption configures a LeaderService.
+type LeaderOption func(l *LeaderService)
+
+// WithLeaderStopTimeout sets how long Stop is given to return when the lease is lost.
+// The default is 10 seconds. Stop on shutdown is bounded by the ServiceManager instead.
+func WithLeaderStopTimeout(timeout time.Duration) LeaderOption {
+	return func(l *LeaderService) {
+		l.stopTimeout = timeout
+	}
+}
+
+// NewLeaderService wraps service so that it only runs while holding a lease from provider.
+// When it is added to a ServiceManager, it measures time with the manager's Clock.
+func NewLeaderService(service Service, provider LeaseProvider, opts ...LeaderOption) *LeaderService {
+	l := &LeaderService{
+		service:     service,
+		provider:    provider,
+		stopTimeout: defaultStopTimeout,
+		clock:       realClock{},
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
+}
+
+func (l *LeaderService) setClock(clock Clock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.clock = clock
+}
+
+// IsLeader reports whether the lease is currently held.
+func (l *LeaderService) IsLeader() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.lease != nil
+}
+
+func (l *LeaderService) Init(ctx context.Context) error {
+	return l.service.Init(ctx)
+}
+
+func (l *LeaderService) Start(ctx context.Context) error {
+	for term := 0; ; term++ {
+		lease, err := l.provider.Acquire(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		if term > 0 {
+			if err := l.service.Init(ctx); err != nil {
+				_ = lease.Release()
+				return err
+			}
+		}
+
+		lost, err := l.lead(ctx, lease)
+		if !lost {
+			return err
+		}
+	}
+}
+
+// lead runs the service while lease is held. It returns true if the lease was lost,
+// in which case the service has been stopped and the lease should be acquired again.
+func (l *LeaderService) lead(ctx context.Context, lease Lease) (bool, error) {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	l.mu.Lock()
+	l.lease = lease
+	l.active = true
+	l.mu.Unlock()
+
+	result := make(chan error, 1)
+
+	go func() {
+		result <- l.service.Start(runCtx)
+	}()
+
+	select {
+	case err := <-result:
+		// The service returned by itself. Give up the lease so that it can be acquired
+		// again if the service is restarted, but leave the service to be stopped by Stop.
+		l.mu.Lock()
+		l.lease = nil
+		l.mu.Unlock()
+
+		return false, errors.Join(err, lease.Release())
+
+	case <-ctx.Done():
+		return false, <-result
+
+	case <-lease.Lost():
+		cancel()
+		err := <-result
+
+		if ctx.Err() != nil {
+			return false, err
+		}
+
+		l.mu.Lock()
+		clock := l.clock
+		l.mu.Unlock()
+
+		stopCtx, stopCancel := withClockTimeout(context.Background(), clock, l.stopTimeout)
+		defer stopCancel()
+
+		if err := l.stop(stopCtx); err != nil && !errors.Is(err, context.Canceled) {
+			return false, err
+		}
+
+		return true, nil
+	}
+}
+
+// Stop stops the service if it is running and releases the lease.
+func (l *LeaderService) Stop(ctx context.Context) error {
+	return l.stop(ctx)
+}
+
+func (l *LeaderService) stop(ctx context.Context) error {
+	l.mu.Lock()
+	active, lease := l.active, l.lease
+	l.active, l.lease = false, nil
+	l.mu.Unlock()
+
+	var err error
+
+	if active {
+		err = l.service.Stop(ctx)
+	}
+
+	if lease != nil {
+		err = errors.Join(err, lease.Release())
+	}
+
+	return err
+}
+
+// Reload reloads the service if it implements Reloadable.
+func (l *LeaderService) Reload(ctx context.Context) error {
+	if r, ok := l.service.(Reloadable); ok {
+		return r.Reload(ctx)
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package servicemanager_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ordishs/go-utils"
+	"github.com/ordishs/go-utils/servicemanager"
+	"github.com/ordishs/go-utils/servicemanager/smtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// revocableLeaseProvider grants a lease straight away and can revoke it.
+type revocableLeaseProvider struct {
+	mu   sync.Mutex
+	lost chan struct{}
+}
+
+func (p *revocableLeaseProvider) Acquire(ctx context.Context) (servicemanager.Lease, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.lost = make(chan struct{})
+
+	return &revocableLease{provider: p, lost: p.lost}, nil
+}
+
+func (p *revocableLeaseProvider) revoke() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	select {
+	case <-p.lost:
+	default:
+		close(p.lost)
+	}
+}
+
+type revocableLease struct {
+	provider *revocableLeaseProvider
+	lost     chan struct{}
+}
+
+func (l *revocableLease) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *revocableLease) Release() error {
+	l.provider.revoke()
+	return nil
+}
+
+func TestLeaderStopTimeoutUsesManagerClock(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	clock := smtest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	rec := smtest.NewRecorder()
+
+	sm := servicemanager.NewServiceManager(
+		servicemanager.WithLogger(utils.NopLogger{}),
+		servicemanager.WithClock(clock),
+		servicemanager.WithShutdownSignals(),
+	)
+
+	// Stop hangs until its context expires
+	svc := smtest.NewFakeService("pruner", rec).WithClock(clock).ScriptStop(smtest.Result{Delay: time.Hour})
+	provider := &revocableLeaseProvider{}
+
+	leader := servicemanager.NewLeaderService(svc, provider, servicemanager.WithLeaderStopTimeout(time.Minute))
+	require.NoError(t, sm.AddService("pruner", leader))
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- sm.StartAllAndWait(ctx)
+	}()
+
+	require.NoError(t, rec.WaitFor(ctx, "start pruner"))
+
+	timers := clock.Timers()
+
+	provider.revoke()
+
+	require.NoError(t, rec.WaitFor(ctx, "stop pruner"))
+
+	// The stop timeout and the scripted delay of Stop
+	require.NoError(t, clock.WaitForTimers(ctx, timers+2))
+
+	clock.Advance(time.Minute)
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	case <-ctx.Done():
+		t.Fatal("the stop timeout did not expire on the manager's clock")
+	}
+
+	assert.Equal(t, 1, svc.StopCalls())
+}
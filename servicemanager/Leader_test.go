@@ -0,0 +1,110 @@
+package servicemanager
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ordishs/go-utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chanLeaseProvider grants a lease every time a value is sent on grant.
+type chanLeaseProvider struct {
+	grant chan struct{}
+	mu    sync.Mutex
+	lease *chanLease
+}
+
+type chanLease struct {
+	once sync.Once
+	lost chan struct{}
+}
+
+func (l *chanLease) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *chanLease) Release() error {
+	l.once.Do(func() { close(l.lost) })
+	return nil
+}
+
+func (p *chanLeaseProvider) Acquire(ctx context.Context) (Lease, error) {
+	select {
+	case <-p.grant:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.lease = &chanLease{lost: make(chan struct{})}
+
+	return p.lease, nil
+}
+
+func (p *chanLeaseProvider) revoke() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_ = p.lease.Release()
+}
+
+func TestLeaderService(t *testing.T) {
+	sm := NewServiceManager(WithLogger(utils.NopLogger{}), WithShutdownSignals())
+
+	r := &recorder{}
+	provider := &chanLeaseProvider{grant: make(chan struct{})}
+	leader := NewLeaderService(&testService{name: "pruner", recorder: r}, provider)
+
+	require.NoError(t, sm.AddService("pruner", leader))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- sm.StartAllAndWait(ctx)
+	}()
+
+	// Standby replicas are ready but do not run the service
+	require.NoError(t, sm.WaitReady(context.Background()))
+	assert.False(t, leader.IsLeader())
+	assert.Equal(t, []string{"init pruner"}, r.get())
+
+	provider.grant <- struct{}{}
+
+	assert.Eventually(t, func() bool {
+		return len(r.get()) == 2
+	}, time.Second, 5*time.Millisecond)
+	assert.True(t, leader.IsLeader())
+
+	// Losing the lease stops the service until the lease is granted again
+	provider.revoke()
+
+	assert.Eventually(t, func() bool {
+		return len(r.get()) == 3
+	}, time.Second, 5*time.Millisecond)
+	assert.False(t, leader.IsLeader())
+
+	provider.grant <- struct{}{}
+
+	assert.Eventually(t, func() bool {
+		return len(r.get()) == 5
+	}, time.Second, 5*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	assert.Equal(t, []string{
+		"init pruner",
+		"start pruner",
+		"stop pruner",
+		"init pruner",
+		"start pruner",
+		"stop pruner",
+	}, r.get())
+}
@@ -0,0 +1,97 @@
+//go:build unix
+
+package servicemanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const defaultLeaseRetryInterval = time.Second
+
+// FileLeaseProvider is a LeaseProvider backed by an exclusive flock(2) on a file.
+// It elects a leader among processes on a single host, and is also useful in tests.
+// A file lease is only lost when it is released or the process exits.
+type FileLeaseProvider struct {
+	path          string
+	retryInterval time.Duration
+}
+
+// NewFileLeaseProvider creates a FileLeaseProvider that locks the file at path,
+// creating it if needed, and retries every retryInterval while another process
+// holds the lock. A retryInterval of 0 defaults to one second.
+func NewFileLeaseProvider(path string, retryInterval time.Duration) *FileLeaseProvider {
+	if retryInterval <= 0 {
+		retryInterval = defaultLeaseRetryInterval
+	}
+
+	return &FileLeaseProvider{
+		path:          path,
+		retryInterval: retryInterval,
+	}
+}
+
+func (p *FileLeaseProvider) Acquire(ctx context.Context) (Lease, error) {
+	f, err := os.OpenFile(p.path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, syscall.EWOULDBLOCK) && !errors.Is(err, syscall.EINTR) {
+			_ = f.Close()
+			return nil, fmt.Errorf("could not lock %s: %w", p.path, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			_ = f.Close()
+			return nil, ctx.Err()
+		case <-time.After(p.retryInterval):
+		}
+	}
+
+	// Record the holder to help with debugging
+	if err := f.Truncate(0); err == nil {
+		_, _ = f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+
+	return &fileLease{
+		file: f,
+		lost: make(chan struct{}),
+	}, nil
+}
+
+type fileLease struct {
+	file *os.File
+	once sync.Once
+	lost chan struct{}
+}
+
+func (l *fileLease) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *fileLease) Release() error {
+	var err error
+
+	l.once.Do(func() {
+		close(l.lost)
+
+		err = syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+		err = errors.Join(err, l.file.Close())
+	})
+
+	return err
+}
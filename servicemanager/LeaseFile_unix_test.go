@@ -0,0 +1,52 @@
+//go:build unix
+
+package servicemanager
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileLeaseProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leader.lock")
+
+	first := NewFileLeaseProvider(path, 10*time.Millisecond)
+	second := NewFileLeaseProvider(path, 10*time.Millisecond)
+
+	lease, err := first.Acquire(context.Background())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = second.Acquire(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	acquired := make(chan Lease)
+
+	go func() {
+		l, err := second.Acquire(context.Background())
+		assert.NoError(t, err)
+		acquired <- l
+	}()
+
+	require.NoError(t, lease.Release())
+
+	select {
+	case <-lease.Lost():
+	default:
+		t.Fatal("released lease should be lost")
+	}
+
+	select {
+	case l := <-acquired:
+		require.NoError(t, l.Release())
+	case <-time.After(time.Second):
+		t.Fatal("lease was not acquired after it was released")
+	}
+}
@@ -0,0 +1,43 @@
+package servicemanager
+
+import (
+	"github.com/ordishs/go-utils"
+)
+
+// serviceLogger prefixes every message with the name of the service it belongs to,
+// so that all messages about a service have the same "[name] " prefix.
+type serviceLogger struct {
+	logger utils.Logger
+	prefix string
+}
+
+func newServiceLogger(logger utils.Logger, name string) *serviceLogger {
+	return &serviceLogger{
+		logger: logger,
+		prefix: "[" + name + "] ",
+	}
+}
+
+func (l *serviceLogger) LogLevel() int {
+	return l.logger.LogLevel()
+}
+
+func (l *serviceLogger) Debugf(format string, args ...interface{}) {
+	l.logger.Debugf(l.prefix+format, args...)
+}
+
+func (l *serviceLogger) Infof(format string, args ...interface{}) {
+	l.logger.Infof(l.prefix+format, args...)
+}
+
+func (l *serviceLogger) Warnf(format string, args ...interface{}) {
+	l.logger.Warnf(l.prefix+format, args...)
+}
+
+func (l *serviceLogger) Errorf(format string, args ...interface{}) {
+	l.logger.Errorf(l.prefix+format, args...)
+}
+
+func (l *serviceLogger) Fatalf(format string, args ...interface{}) {
+	l.logger.Fatalf(l.prefix+format, args...)
+}
@@ -0,0 +1,76 @@
+package servicemanager
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// prometheusMetrics holds the collectors that export the lifecycle of the services.
+type prometheusMetrics struct {
+	state       *prometheus.GaugeVec
+	transitions *prometheus.CounterVec
+	restarts    *prometheus.CounterVec
+}
+
+// newPrometheusMetrics registers the collectors with registerer. Collectors that are
+// already registered, for example by another ServiceManager, are reused.
+func newPrometheusMetrics(registerer prometheus.Registerer) (*prometheusMetrics, error) {
+	m := &prometheusMetrics{}
+
+	var err error
+
+	if m.state, err = register(registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "servicemanager",
+		Name:      "service_state",
+		Help:      "The current state of each service, 1 for the current state and 0 for all others",
+	}, []string{"service", "state"})); err != nil {
+		return nil, err
+	}
+
+	if m.transitions, err = register(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "servicemanager",
+		Name:      "service_transitions_total",
+		Help:      "The number of times each service entered each state",
+	}, []string{"service", "state"})); err != nil {
+		return nil, err
+	}
+
+	if m.restarts, err = register(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "servicemanager",
+		Name:      "service_restarts_total",
+		Help:      "The number of times each service was restarted",
+	}, []string{"service"})); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func register[C prometheus.Collector](registerer prometheus.Registerer, c C) (C, error) {
+	if err := registerer.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if !errors.As(err, &are) {
+			return c, err
+		}
+
+		existing, ok := are.ExistingCollector.(C)
+		if !ok {
+			return c, err
+		}
+
+		return existing, nil
+	}
+
+	return c, nil
+}
+
+func (m *prometheusMetrics) hook(e Event) {
+	m.state.WithLabelValues(e.Service, e.From.String()).Set(0)
+	m.state.WithLabelValues(e.Service, e.To.String()).Set(1)
+	m.transitions.WithLabelValues(e.Service, e.To.String()).Inc()
+
+	if e.To == StateRestarting {
+		m.restarts.WithLabelValues(e.Service).Inc()
+	}
+}
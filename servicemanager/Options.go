@@ -0,0 +1,168 @@
+package servicemanager
+
+import (
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/ordishs/go-utils"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Option configures a ServiceManager.
+type Option func(sm *ServiceManager)
+
+// WithInitTimeout sets the default time each service is given to initialise.
+// The default of 0 means no timeout.
+func WithInitTimeout(timeout time.Duration) Option {
+	return func(sm *ServiceManager) {
+		sm.initTimeout = timeout
+	}
+}
+
+// WithParallelInit initialises services concurrently. A service is still only
+// initialised once all of its dependencies have been initialised.
+func WithParallelInit() Option {
+	return func(sm *ServiceManager) {
+		sm.parallelInit = true
+	}
+}
+
+// WithStopTimeout sets the default time each service is given to stop.
+// The default is 10 seconds.
+func WithStopTimeout(timeout time.Duration) Option {
+	return func(sm *ServiceManager) {
+		sm.stopTimeout = timeout
+	}
+}
+
+// WithShutdownTimeout sets an overall deadline for stopping all services. If it is
+// exceeded, the services that have not stopped are reported and the process exits.
+// The default of 0 waits for every service to stop or reach its own stop timeout.
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(sm *ServiceManager) {
+		sm.shutdownTimeout = timeout
+	}
+}
+
+// WithParallelStop stops services concurrently. A service is still only stopped
+// once all services that depend on it have stopped.
+func WithParallelStop() Option {
+	return func(sm *ServiceManager) {
+		sm.parallelStop = true
+	}
+}
+
+// WithShutdownSignals sets the signals that stop all services. The default is SIGINT
+// and SIGTERM. A shutdown signal received while services are already stopping exits
+// the process immediately. Calling it without signals disables signal handling.
+func WithShutdownSignals(sigs ...os.Signal) Option {
+	return func(sm *ServiceManager) {
+		sm.shutdownSignals = sigs
+	}
+}
+
+// WithReloadSignals sets the signals that call Reload on every service that implements
+// Reloadable. The default is SIGHUP. Calling it without signals disables reloading.
+func WithReloadSignals(sigs ...os.Signal) Option {
+	return func(sm *ServiceManager) {
+		sm.reloadSignals = sigs
+	}
+}
+
+// WithPrometheus exports the state, transitions and restarts of every service as
+// Prometheus metrics, registered with registerer, or with prometheus.DefaultRegisterer
+// if registerer is nil. Managers that share a registerer share the metrics.
+func WithPrometheus(registerer prometheus.Registerer) Option {
+	return func(sm *ServiceManager) {
+		if registerer == nil {
+			registerer = prometheus.DefaultRegisterer
+		}
+
+		sm.prometheus = registerer
+	}
+}
+
+// WithLogger sets the logger used by the ServiceManager. Messages about a service
+// are prefixed with "[name] ". The default logs to slog.Default(); use
+// utils.NopLogger{} to discard all messages.
+func WithLogger(logger utils.Logger) Option {
+	return func(sm *ServiceManager) {
+		if logger == nil {
+			logger = utils.NopLogger{}
+		}
+
+		sm.logger = logger
+	}
+}
+
+// WithSlogLogger logs to logger. If logger is nil, slog.Default() is used.
+func WithSlogLogger(logger *slog.Logger) Option {
+	return WithLogger(utils.NewSlogLogger(logger))
+}
+
+// WithClock sets the clock used for timestamps, timeouts and restart backoffs.
+// It is intended for tests; the default is the system clock.
+func WithClock(clock Clock) Option {
+	return func(sm *ServiceManager) {
+		sm.clock = clock
+	}
+}
+
+// WithSignalNotifier sets the source of the shutdown and reload signals.
+// It is intended for tests; the default relays OS signals using os/signal.
+func WithSignalNotifier(notifier SignalNotifier) Option {
+	return func(sm *ServiceManager) {
+		sm.signals = notifier
+	}
+}
+
+// WithExitFunc sets the function called when the process must exit, either because
+// a second shutdown signal was received or because the shutdown timeout expired.
+// The default is os.Exit.
+func WithExitFunc(exit func(code int)) Option {
+	return func(sm *ServiceManager) {
+		sm.exit = exit
+	}
+}
+
+// ServiceOption configures how a service is managed by the ServiceManager.
+type ServiceOption func(s *serviceWrapper)
+
+// DependsOn declares the services that must be ready before this service is started.
+// Dependencies are initialised before and stopped after the services that depend on them.
+func DependsOn(names ...string) ServiceOption {
+	return func(s *serviceWrapper) {
+		s.dependsOn = append(s.dependsOn, names...)
+	}
+}
+
+// InitTimeout overrides the time the service is given to initialise.
+func InitTimeout(timeout time.Duration) ServiceOption {
+	return func(s *serviceWrapper) {
+		s.initTimeout = timeout
+	}
+}
+
+// StopTimeout overrides the time the service is given to stop.
+func StopTimeout(timeout time.Duration) ServiceOption {
+	return func(s *serviceWrapper) {
+		s.stopTimeout = timeout
+	}
+}
+
+// Restart sets the restart policy of the service. By default services are never restarted.
+func Restart(policy RestartPolicy) ServiceOption {
+	return func(s *serviceWrapper) {
+		s.restartPolicy = policy
+	}
+}
+
+// Critical controls whether a failure of the service stops all other services.
+// Services are critical by default. A non-critical service that fails, and is not
+// restarted, is left in the failed state while the other services keep running.
+func Critical(critical bool) ServiceOption {
+	return func(s *serviceWrapper) {
+		s.critical = critical
+	}
+}
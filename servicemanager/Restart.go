@@ -0,0 +1,162 @@
+package servicemanager
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RestartMode controls when a service is restarted after its Start method returns.
+type RestartMode int
+
+const (
+	RestartNever     RestartMode = iota // Never restart the service (default)
+	RestartOnFailure                    // Restart the service when Start returns an error
+	RestartAlways                       // Restart the service whenever Start returns
+)
+
+const (
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 30 * time.Second
+)
+
+// RestartPolicy describes how a service is restarted.
+// When a service is restarted, Start is called again; Init and Stop are not called
+// between restarts.
+type RestartPolicy struct {
+	Mode              RestartMode
+	MaxRestarts       int           // Maximum number of restarts, 0 means no limit
+	InitialBackoff    time.Duration // Delay before the first restart, defaults to 100ms
+	MaxBackoff        time.Duration // The delay doubles with every restart up to MaxBackoff, defaults to 30s
+	CrashLoopRestarts int           // Give up when this many restarts happen within CrashLoopWindow, 0 disables the check
+	CrashLoopWindow   time.Duration // Window used by the crash loop detector
+}
+
+func (p RestartPolicy) initialBackoff() time.Duration {
+	if p.InitialBackoff > 0 {
+		return p.InitialBackoff
+	}
+
+	return defaultInitialBackoff
+}
+
+func (p RestartPolicy) maxBackoff() time.Duration {
+	if p.MaxBackoff > 0 {
+		return p.MaxBackoff
+	}
+
+	return defaultMaxBackoff
+}
+
+func (p RestartPolicy) shouldRestart(err error) bool {
+	switch p.Mode {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return err != nil
+	default:
+		return false
+	}
+}
+
+// runService calls Start on the service and restarts it according to its restart policy.
+// An error is only returned for critical services, and causes all services to be stopped.
+func (sm *ServiceManager) runService(ctx context.Context, s *serviceWrapper) error {
+	policy := s.restartPolicy
+	backoff := policy.initialBackoff()
+
+	var restartTimes []time.Time
+
+	for {
+		started := s.clock.Now()
+
+		s.logger.Infof("Starting service...")
+		s.setState(StateStarting, nil)
+
+		if !signalsReady(s.instance) {
+			s.markReady()
+		}
+
+		err := s.instance.Start(withReadyFunc(ctx, s.markReady))
+
+		if ctx.Err() != nil {
+			// The service manager is shutting down
+			if err != nil && !errors.Is(err, context.Canceled) {
+				s.setState(StateFailed, err)
+			}
+
+			return err
+		}
+
+		if err != nil {
+			s.logger.Errorf("Service failed: %v", err)
+			s.setState(StateFailed, err)
+		}
+
+		giveUp := !policy.shouldRestart(err)
+
+		if !giveUp && policy.MaxRestarts > 0 && s.restartCount() >= policy.MaxRestarts {
+			s.logger.Errorf("Service reached the maximum of %d restarts", policy.MaxRestarts)
+			giveUp = true
+		}
+
+		if !giveUp && policy.CrashLoopRestarts > 0 {
+			now := s.clock.Now()
+
+			recent := restartTimes[:0]
+			for _, t := range restartTimes {
+				if now.Sub(t) < policy.CrashLoopWindow {
+					recent = append(recent, t)
+				}
+			}
+			restartTimes = recent
+
+			if len(restartTimes) >= policy.CrashLoopRestarts {
+				s.logger.Errorf("Service is crash looping: %d restarts within %s", len(restartTimes), policy.CrashLoopWindow)
+				giveUp = true
+			}
+		}
+
+		if giveUp {
+			if err == nil {
+				s.logger.Infof("Service exited")
+				s.markExited()
+
+				return nil
+			}
+
+			if s.critical {
+				return err
+			}
+
+			s.logger.Warnf("Non-critical service failed, other services keep running")
+
+			return nil
+		}
+
+		// Reset the backoff when the service ran for longer than the maximum backoff
+		if s.clock.Now().Sub(started) > policy.maxBackoff() {
+			backoff = policy.initialBackoff()
+		}
+
+		s.logger.Infof("Restarting service in %s...", backoff)
+		s.setState(StateRestarting, err)
+
+		timer := s.clock.NewTimer(backoff)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C():
+		}
+
+		s.addRestart()
+		restartTimes = append(restartTimes, s.clock.Now())
+
+		backoff *= 2
+		if backoff > policy.maxBackoff() {
+			backoff = policy.maxBackoff()
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package servicemanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// StartService initialises and starts a registered service on a running ServiceManager.
+// It is used for services that are added with AddService after StartAllAndWait was
+// called, and to start services again after StopService. Init is called every time the
+// service is started. StartService returns once Init has completed; the service is
+// started as soon as its dependencies are ready.
+func (sm *ServiceManager) StartService(ctx context.Context, name string) error {
+	sm.mu.Lock()
+
+	s := sm.find(name)
+	if s == nil {
+		sm.mu.Unlock()
+		return fmt.Errorf("service %q is not registered", name)
+	}
+
+	if !sm.running {
+		sm.mu.Unlock()
+		return errors.New("service manager is not running")
+	}
+
+	for _, dep := range s.dependsOn {
+		if sm.find(dep) == nil {
+			sm.mu.Unlock()
+			return fmt.Errorf("service %q depends on unknown service %q", name, dep)
+		}
+	}
+
+	if !s.setRunning() {
+		sm.mu.Unlock()
+		return fmt.Errorf("service %q is already running", name)
+	}
+
+	sm.mu.Unlock()
+
+	s.resetReady()
+
+	if err := sm.initService(ctx, s); err != nil {
+		return err
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if !sm.running {
+		s.clearRunning()
+		return errors.New("service manager is stopping")
+	}
+
+	sm.startLocked(s)
+
+	return nil
+}
+
+// StopService stops a single service on a running ServiceManager. The context passed
+// to its Start method is cancelled, and Stop is called once Start has returned.
+// A service cannot be stopped while services that depend on it are running.
+// The service stays registered and can be started again with StartService.
+func (sm *ServiceManager) StopService(ctx context.Context, name string) error {
+	sm.mu.RLock()
+
+	s := sm.find(name)
+	if s == nil {
+		sm.mu.RUnlock()
+		return fmt.Errorf("service %q is not registered", name)
+	}
+
+	for _, other := range sm.services {
+		if other != s && other.isActive() && dependsOn(other, name) {
+			sm.mu.RUnlock()
+			return fmt.Errorf("service %q cannot be stopped while %q depends on it", name, other.name)
+		}
+	}
+
+	sm.mu.RUnlock()
+
+	switch state := s.getState(); {
+	case state == StateRegistered, state == StateStopping, state == StateStopped && !s.hasExited():
+		return fmt.Errorf("service %q is not running", name)
+	}
+
+	if cancel, done := s.getRun(); cancel != nil {
+		cancel()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return fmt.Errorf("service %q did not return from Start: %w", name, ctx.Err())
+		}
+	}
+
+	return sm.stopService(s)
+}
+
+// RemoveService stops the service if it is running and unregisters it.
+// A service cannot be removed while other registered services depend on it.
+func (sm *ServiceManager) RemoveService(ctx context.Context, name string) error {
+	sm.mu.RLock()
+
+	s := sm.find(name)
+	if s == nil {
+		sm.mu.RUnlock()
+		return fmt.Errorf("service %q is not registered", name)
+	}
+
+	for _, other := range sm.services {
+		if other != s && dependsOn(other, name) {
+			sm.mu.RUnlock()
+			return fmt.Errorf("service %q cannot be removed while %q depends on it", name, other.name)
+		}
+	}
+
+	sm.mu.RUnlock()
+
+	switch state := s.getState(); {
+	case state == StateRegistered, state == StateStopped && !s.hasExited():
+	default:
+		if err := sm.StopService(ctx, name); err != nil {
+			return err
+		}
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	for i, other := range sm.services {
+		if other == s {
+			sm.services = append(sm.services[:i], sm.services[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+func dependsOn(s *serviceWrapper, name string) bool {
+	for _, dep := range s.dependsOn {
+		if dep == name {
+			return true
+		}
+	}
+
+	return false
+}
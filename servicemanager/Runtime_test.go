@@ -0,0 +1,86 @@
+package servicemanager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ordishs/go-utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuntimeServices(t *testing.T) {
+	sm := NewServiceManager(WithLogger(utils.NopLogger{}))
+
+	r := &recorder{}
+
+	require.NoError(t, sm.AddService("main", &testService{name: "main", recorder: r}))
+
+	assert.Error(t, sm.StartService(context.Background(), "main"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error)
+
+	go func() {
+		done <- sm.StartAllAndWait(ctx)
+	}()
+
+	require.NoError(t, sm.WaitReady(context.Background()))
+
+	require.NoError(t, sm.AddService("peer1", &testService{name: "peer1", recorder: r}, DependsOn("main")))
+	require.NoError(t, sm.AddService("peer1-sync", &testService{name: "peer1-sync", recorder: r}, DependsOn("peer1")))
+
+	state, err := sm.State("peer1")
+	require.NoError(t, err)
+	assert.Equal(t, StateRegistered, state)
+
+	require.NoError(t, sm.StartService(context.Background(), "peer1"))
+	require.NoError(t, sm.StartService(context.Background(), "peer1-sync"))
+	assert.Error(t, sm.StartService(context.Background(), "peer1"))
+
+	require.NoError(t, sm.WaitReady(context.Background()))
+
+	// peer1-sync depends on peer1
+	assert.Error(t, sm.StopService(context.Background(), "peer1"))
+	assert.Error(t, sm.RemoveService(context.Background(), "peer1"))
+
+	require.NoError(t, sm.StopService(context.Background(), "peer1-sync"))
+
+	state, err = sm.State("peer1-sync")
+	require.NoError(t, err)
+	assert.Equal(t, StateStopped, state)
+
+	assert.Error(t, sm.StopService(context.Background(), "peer1-sync"))
+
+	// Restart it
+	require.NoError(t, sm.StartService(context.Background(), "peer1-sync"))
+
+	assert.Eventually(t, func() bool {
+		state, _ := sm.State("peer1-sync")
+		return state == StateReady
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, sm.RemoveService(context.Background(), "peer1-sync"))
+	require.NoError(t, sm.RemoveService(context.Background(), "peer1"))
+
+	_, err = sm.State("peer1")
+	assert.Error(t, err)
+	assert.Len(t, sm.Status(), 1)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	events := r.get()
+	require.Len(t, events, 12)
+
+	assert.Equal(t, []string{"init main", "start main"}, events[:2])
+	assert.ElementsMatch(t, []string{"init peer1", "init peer1-sync", "start peer1", "start peer1-sync"}, events[2:6])
+	assert.Equal(t, []string{
+		"stop peer1-sync",
+		"init peer1-sync", "start peer1-sync",
+		"stop peer1-sync", "stop peer1",
+		"stop main",
+	}, events[6:])
+}
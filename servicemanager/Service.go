@@ -8,3 +8,38 @@ type Service interface {
 	Start(ctx context.Context) error
 	Stop(ctx context.Context) error
 }
+
+// Reloadable is an optional interface for services that can reload their configuration,
+// certificates etc. without being restarted. Reload is called when the ServiceManager
+// receives a reload signal (SIGHUP by default).
+type Reloadable interface {
+	Reload(ctx context.Context) error
+}
+
+// ReadySignaller is an optional interface for services that announce when they are
+// serving by calling SignalReady with the context passed to Start.
+// Services that do not implement it, or return false, are considered ready as soon
+// as Start has been called.
+type ReadySignaller interface {
+	SignalsReady() bool
+}
+
+type readyKey struct{}
+
+// SignalReady announces that the service that was started with ctx is ready.
+// It is safe to call more than once and does nothing if ctx was not passed
+// to Start by a ServiceManager.
+func SignalReady(ctx context.Context) {
+	if fn, ok := ctx.Value(readyKey{}).(func()); ok {
+		fn()
+	}
+}
+
+func withReadyFunc(ctx context.Context, fn func()) context.Context {
+	return context.WithValue(ctx, readyKey{}, fn)
+}
+
+func signalsReady(service Service) bool {
+	rs, ok := service.(ReadySignaller)
+	return ok && rs.SignalsReady()
+}
@@ -2,113 +2,318 @@ package servicemanager
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
-	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/ordishs/go-utils"
-	"github.com/ordishs/gocore"
+	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/sync/errgroup"
 )
 
-type serviceWrapper struct {
-	name     string
-	instance Service
+type ServiceManager struct {
+	mu              sync.RWMutex
+	services        []*serviceWrapper
+	running         bool
+	runCtx          context.Context
+	group           *errgroup.Group
+	logger          utils.Logger
+	stopping        chan struct{}
+	stoppingOnce    sync.Once
+	stopTimeout     time.Duration
+	shutdownTimeout time.Duration
+	parallelStop    bool
+	parallelInit    bool
+	initTimeout     time.Duration
+	shutdownSignals []os.Signal
+	reloadSignals   []os.Signal
+	reloadMu        sync.Mutex
+	eventsMu        sync.RWMutex
+	hooks           []hook
+	subscribers     map[chan Event]struct{}
+	prometheus      prometheus.Registerer
+	exit            func(code int)
+	clock           Clock
+	signals         SignalNotifier
 }
 
-type ServiceManager struct {
-	services []serviceWrapper
-	logger   utils.Logger
+func NewServiceManager(opts ...Option) *ServiceManager {
+	sm := &ServiceManager{
+		services:        make([]*serviceWrapper, 0),
+		logger:          utils.NewSlogLogger(slog.Default().With("component", "sm")),
+		stopping:        make(chan struct{}),
+		stopTimeout:     defaultStopTimeout,
+		shutdownSignals: []os.Signal{syscall.SIGINT, syscall.SIGTERM},
+		reloadSignals:   []os.Signal{syscall.SIGHUP},
+		subscribers:     make(map[chan Event]struct{}),
+		exit:            os.Exit,
+		clock:           realClock{},
+		signals:         osSignalNotifier{},
+	}
+
+	for _, opt := range opts {
+		opt(sm)
+	}
+
+	if sm.prometheus != nil {
+		metrics, err := newPrometheusMetrics(sm.prometheus)
+		if err != nil {
+			sm.logger.Errorf("Failed to register Prometheus metrics: %v", err)
+		} else {
+			sm.AddHook(metrics.hook)
+		}
+	}
+
+	return sm
 }
 
-func NewServiceManager() *ServiceManager {
-	return &ServiceManager{
-		services: make([]serviceWrapper, 0),
-		logger:   gocore.Log("sm"),
+// AddService registers a service with the given name.
+// An error is returned if the name is already registered or if the declared
+// dependencies introduce a cycle with services that are already registered.
+// Dependencies may be registered after the services that depend on them.
+// AddService is safe to call while the ServiceManager is running, in which case
+// the service is started by calling StartService.
+func (sm *ServiceManager) AddService(name string, service Service, opts ...ServiceOption) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.find(name) != nil {
+		return fmt.Errorf("service %q is already registered", name)
 	}
+
+	if cu, ok := service.(clockUser); ok {
+		cu.setClock(sm.clock)
+	}
+
+	s := newServiceWrapper(name, service, sm.clock)
+	s.logger = newServiceLogger(sm.logger, name)
+	s.onTransition = sm.emit
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	sm.services = append(sm.services, s)
+
+	if cycle := sm.findCycle(); cycle != nil {
+		sm.services = sm.services[:len(sm.services)-1]
+		return fmt.Errorf("service %q introduces a dependency cycle: %v", name, cycle)
+	}
+
+	return nil
 }
 
-func (sm *ServiceManager) AddService(name string, service Service) {
-	sm.services = append(sm.services, serviceWrapper{
-		name:     name,
-		instance: service,
+// State returns the current lifecycle state of the named service.
+func (sm *ServiceManager) State(name string) (ServiceState, error) {
+	sm.mu.RLock()
+	s := sm.find(name)
+	sm.mu.RUnlock()
+
+	if s == nil {
+		return StateRegistered, fmt.Errorf("service %q is not registered", name)
+	}
+
+	return s.getState(), nil
+}
+
+// Status returns a snapshot of the status of all registered services.
+func (sm *ServiceManager) Status() []ServiceStatus {
+	services := sm.snapshot()
+
+	statuses := make([]ServiceStatus, 0, len(services))
+
+	for _, s := range services {
+		statuses = append(statuses, s.status())
+	}
+
+	return statuses
+}
+
+// WaitReady blocks until every registered service is ready. It returns an error
+// if ctx is done first, or if the ServiceManager starts shutting down before all
+// services became ready.
+func (sm *ServiceManager) WaitReady(ctx context.Context) error {
+	for _, s := range sm.snapshot() {
+		select {
+		case <-sm.stopping:
+			return fmt.Errorf("[%s] not ready: service manager is stopping", s.name)
+		default:
+		}
+
+		select {
+		case <-s.readyChan():
+		case <-sm.stopping:
+			return fmt.Errorf("[%s] not ready: service manager is stopping", s.name)
+		case <-ctx.Done():
+			return fmt.Errorf("[%s] not ready: %w", s.name, ctx.Err())
+		}
+	}
+
+	return nil
+}
+
+func (sm *ServiceManager) setStopping() {
+	sm.stoppingOnce.Do(func() {
+		close(sm.stopping)
 	})
 }
 
+// snapshot returns a copy of the list of registered services.
+func (sm *ServiceManager) snapshot() []*serviceWrapper {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	return append([]*serviceWrapper{}, sm.services...)
+}
+
+// find returns the named service, or nil. The caller must hold sm.mu.
+func (sm *ServiceManager) find(name string) *serviceWrapper {
+	for _, s := range sm.services {
+		if s.name == name {
+			return s
+		}
+	}
+
+	return nil
+}
+
 // StartAllAndWait starts all services and waits for them to complete or error.
-// If any service errors, all other services are stopped gracefully and the error is returned.
+// Services are initialised in dependency order (see WithParallelInit). If any service
+// fails to initialise, the services that were initialised are stopped and an *InitError
+// listing every failure is returned. Each service is started only
+// after all of its dependencies are ready (see ReadySignaller).
+// Services are restarted according to their restart policy (see Restart). If a
+// critical service errors, all other services are stopped gracefully in reverse
+// dependency order and the error is returned. Each service is given its stop
+// timeout to stop (see WithStopTimeout and StopTimeout).
+// StartAllAndWait also returns when every service, including those started with
+// StartService, has returned from Start.
 func (sm *ServiceManager) StartAllAndWait(ctx context.Context) error {
+	defer sm.setStopping()
+
+	sm.mu.Lock()
+
+	if sm.running {
+		sm.mu.Unlock()
+		return errors.New("service manager is already running")
+	}
+
+	services, err := sm.sortServices()
+	if err != nil {
+		sm.mu.Unlock()
+		return err
+	}
+
+	for _, service := range services {
+		service.setRunning()
+	}
+
+	sm.mu.Unlock()
+
 	cancelCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	// Listen for system signals
-	go func() {
-		sigs := make(chan os.Signal, 1)
-		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	stopSignals := sm.handleSignals(cancelCtx, cancel)
+	defer stopSignals()
 
-		<-sigs
-		sm.logger.Infof("Received shutdown signal. Stopping services...")
-		cancel()
-	}()
-
-	// Init all services in series (not in the background)
-	for _, service := range sm.services {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
+	// Init all services, in series unless WithParallelInit is used
+	if initialised, err := sm.initServices(cancelCtx, services); err != nil {
+		sm.setStopping()
 
-		default:
-			sm.logger.Infof("[%s] Initializing service...", service.name)
-			if err := service.instance.Init(cancelCtx); err != nil {
-				return err
-			}
+		// Stop the services that were initialised before the failure
+		if failed := sm.stopServices(initialised); len(failed) > 0 {
+			sm.logger.Warnf("Services that failed to stop: %s", strings.Join(failed, ", "))
 		}
+
+		return err
 	}
 
-	g, ctx := errgroup.WithContext(cancelCtx) // Use cancelCtx here
+	g, gCtx := errgroup.WithContext(cancelCtx) // Use cancelCtx here
 
-	// Start all services
-	for _, service := range sm.services {
-		s := service // capture the loop variable
+	sm.mu.Lock()
 
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
+	sm.running = true
+	sm.runCtx = gCtx
+	sm.group = g
 
-		default:
-			sm.logger.Infof("[%s] Starting service...", s.name)
-
-			g.Go(func() error {
-				return s.instance.Start(ctx)
-			})
-		}
+	// Start all services, each one as soon as its dependencies are ready
+	for _, service := range services {
+		sm.startLocked(service)
 	}
 
+	sm.mu.Unlock()
+
 	// Wait for all services to complete or error
-	err := g.Wait()
+	err = g.Wait()
 	if err != nil {
 		sm.logger.Errorf("Received error: %v", err)
 	}
 
-	for i := len(sm.services) - 1; i >= 0; i-- {
-		service := sm.services[i]
+	sm.mu.Lock()
 
-		// Ensure all other services are stopped gracefully with a 10-second timeout
-		stopCtx, stopCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	sm.running = false
 
-		sm.logger.Infof("[%s] Stopping service...", service.name)
+	// Include services that were added while running
+	if sorted, sortErr := sm.sortServices(); sortErr == nil {
+		services = sorted
+	} else {
+		services = append([]*serviceWrapper{}, sm.services...)
+	}
 
-		if err := service.instance.Stop(stopCtx); err != nil {
-			sm.logger.Warnf("[%s] Failed to stop service: %v", service.name, err)
-		} else {
-			sm.logger.Infof("[%s] Service stopped gracefully", service.name)
-		}
+	sm.mu.Unlock()
+
+	sm.setStopping()
+	cancel()
 
-		stopCancel()
+	if failed := sm.stopServices(services); len(failed) > 0 {
+		sm.logger.Warnf("Services that failed to stop: %s", strings.Join(failed, ", "))
 	}
 
 	sm.logger.Infof("\U0001f6d1 All services stopped.")
 
 	return err // This is the original error
 }
+
+// startLocked starts the service in the errgroup of the running ServiceManager as soon
+// as its dependencies are ready. The caller must hold sm.mu.
+func (sm *ServiceManager) startLocked(s *serviceWrapper) {
+	deps := make([]<-chan struct{}, 0, len(s.dependsOn))
+	for _, dep := range s.dependsOn {
+		deps = append(deps, sm.find(dep).readyChan())
+	}
+
+	runCtx := sm.runCtx
+	ctx, cancel := context.WithCancel(runCtx)
+	done := make(chan struct{})
+
+	s.setRun(cancel, done)
+
+	sm.group.Go(func() error {
+		defer close(done)
+		defer s.clearRunning()
+		defer cancel()
+
+		for _, ready := range deps {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ready:
+			}
+		}
+
+		err := sm.runService(ctx, s)
+
+		if runCtx.Err() == nil && ctx.Err() != nil {
+			// Stopped by StopService
+			return nil
+		}
+
+		return err
+	})
+}
@@ -0,0 +1,459 @@
+package servicemanager
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ordishs/go-utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.events...)
+}
+
+type testService struct {
+	name      string
+	recorder  *recorder
+	initErr   error
+	initDelay time.Duration
+	startErr  error
+	stopDelay time.Duration
+}
+
+func (s *testService) Init(ctx context.Context) error {
+	if s.initDelay > 0 {
+		time.Sleep(s.initDelay)
+	}
+
+	s.recorder.add("init " + s.name)
+
+	return s.initErr
+}
+
+func (s *testService) Start(ctx context.Context) error {
+	s.recorder.add("start " + s.name)
+
+	if s.startErr != nil {
+		return s.startErr
+	}
+
+	<-ctx.Done()
+
+	return nil
+}
+
+func (s *testService) Stop(ctx context.Context) error {
+	if s.stopDelay > 0 {
+		time.Sleep(s.stopDelay)
+	}
+
+	s.recorder.add("stop " + s.name)
+
+	return nil
+}
+
+func TestAddServiceRejectsCycles(t *testing.T) {
+	sm := NewServiceManager(WithLogger(utils.NopLogger{}))
+
+	r := &recorder{}
+
+	require.NoError(t, sm.AddService("a", &testService{name: "a", recorder: r}, DependsOn("c")))
+	require.NoError(t, sm.AddService("b", &testService{name: "b", recorder: r}, DependsOn("a")))
+
+	err := sm.AddService("c", &testService{name: "c", recorder: r}, DependsOn("b"))
+	assert.ErrorContains(t, err, "dependency cycle")
+
+	err = sm.AddService("a", &testService{name: "a", recorder: r})
+	assert.ErrorContains(t, err, "already registered")
+}
+
+func TestStartAllAndWaitUnknownDependency(t *testing.T) {
+	sm := NewServiceManager(WithLogger(utils.NopLogger{}))
+
+	require.NoError(t, sm.AddService("a", &testService{name: "a", recorder: &recorder{}}, DependsOn("missing")))
+
+	err := sm.StartAllAndWait(context.Background())
+	assert.ErrorContains(t, err, "unknown service")
+}
+
+func TestStartAllAndWaitDependencyOrder(t *testing.T) {
+	sm := NewServiceManager(WithLogger(utils.NopLogger{}))
+
+	r := &recorder{}
+	errFailed := errors.New("failed")
+
+	require.NoError(t, sm.AddService("api", &testService{name: "api", recorder: r, startErr: errFailed}, DependsOn("cache", "db")))
+	require.NoError(t, sm.AddService("cache", &testService{name: "cache", recorder: r}, DependsOn("db")))
+	require.NoError(t, sm.AddService("db", &testService{name: "db", recorder: r}))
+
+	err := sm.StartAllAndWait(context.Background())
+	assert.ErrorIs(t, err, errFailed)
+
+	events := r.get()
+	require.Len(t, events, 9)
+
+	assert.Equal(t, []string{"init db", "init cache", "init api"}, events[:3])
+	assert.ElementsMatch(t, []string{"start db", "start cache", "start api"}, events[3:6])
+	assert.Equal(t, []string{"stop api", "stop cache", "stop db"}, events[6:])
+}
+
+type readyService struct {
+	testService
+	delay time.Duration
+}
+
+func (s *readyService) SignalsReady() bool {
+	return true
+}
+
+func (s *readyService) Start(ctx context.Context) error {
+	s.recorder.add("start " + s.name)
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-time.After(s.delay):
+	}
+
+	s.recorder.add("ready " + s.name)
+	SignalReady(ctx)
+
+	<-ctx.Done()
+
+	return nil
+}
+
+func TestStartAllAndWaitReadiness(t *testing.T) {
+	sm := NewServiceManager(WithLogger(utils.NopLogger{}))
+
+	r := &recorder{}
+
+	require.NoError(t, sm.AddService("db", &readyService{testService: testService{name: "db", recorder: r}, delay: 50 * time.Millisecond}))
+	require.NoError(t, sm.AddService("api", &testService{name: "api", recorder: r}, DependsOn("db")))
+
+	state, err := sm.State("db")
+	require.NoError(t, err)
+	assert.Equal(t, StateRegistered, state)
+
+	_, err = sm.State("missing")
+	assert.Error(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error)
+
+	go func() {
+		done <- sm.StartAllAndWait(ctx)
+	}()
+
+	require.NoError(t, sm.WaitReady(context.Background()))
+
+	state, err = sm.State("db")
+	require.NoError(t, err)
+	assert.Equal(t, StateReady, state)
+
+	state, err = sm.State("api")
+	require.NoError(t, err)
+	assert.Equal(t, StateReady, state)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	assert.Equal(t, []string{"init db", "init api", "start db", "ready db", "start api", "stop api", "stop db"}, r.get())
+
+	state, err = sm.State("db")
+	require.NoError(t, err)
+	assert.Equal(t, StateStopped, state)
+
+	assert.Error(t, sm.WaitReady(context.Background()))
+}
+
+type deadlineService struct {
+	testService
+	stopDeadline    time.Time
+	stopHasDeadline bool
+	stopErr         chan error
+}
+
+func (s *deadlineService) Stop(ctx context.Context) error {
+	s.stopDeadline, s.stopHasDeadline = ctx.Deadline()
+
+	<-ctx.Done()
+	s.stopErr <- ctx.Err()
+
+	return ctx.Err()
+}
+
+func TestStopContextDeadline(t *testing.T) {
+	sm := NewServiceManager(WithLogger(utils.NopLogger{}))
+
+	r := &recorder{}
+	errFailed := errors.New("failed")
+	svc := &deadlineService{testService: testService{name: "svc", recorder: r}, stopErr: make(chan error, 1)}
+
+	require.NoError(t, sm.AddService("svc", svc, StopTimeout(20*time.Millisecond)))
+	require.NoError(t, sm.AddService("failing", &testService{name: "failing", recorder: r, startErr: errFailed}))
+
+	start := time.Now()
+
+	err := sm.StartAllAndWait(context.Background())
+	assert.ErrorIs(t, err, errFailed)
+
+	assert.ErrorIs(t, <-svc.stopErr, context.DeadlineExceeded)
+	assert.True(t, svc.stopHasDeadline)
+	assert.WithinDuration(t, start.Add(20*time.Millisecond), svc.stopDeadline, time.Second)
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	sm := NewServiceManager(WithLogger(utils.NopLogger{}), WithShutdownTimeout(50*time.Millisecond))
+
+	exitCode := make(chan int, 1)
+	sm.exit = func(code int) {
+		exitCode <- code
+	}
+
+	r := &recorder{}
+	errFailed := errors.New("failed")
+
+	require.NoError(t, sm.AddService("slow", &testService{name: "slow", recorder: r, stopDelay: 500 * time.Millisecond}))
+	require.NoError(t, sm.AddService("failing", &testService{name: "failing", recorder: r, startErr: errFailed}))
+
+	err := sm.StartAllAndWait(context.Background())
+	assert.ErrorIs(t, err, errFailed)
+
+	assert.Equal(t, 1, <-exitCode)
+}
+
+type flakyService struct {
+	testService
+	mu       sync.Mutex
+	failures int
+	starts   int
+}
+
+func (s *flakyService) Start(ctx context.Context) error {
+	s.mu.Lock()
+	s.starts++
+	fail := s.starts <= s.failures
+	s.mu.Unlock()
+
+	if fail {
+		return errors.New("flaky")
+	}
+
+	<-ctx.Done()
+
+	return nil
+}
+
+func (s *flakyService) getStarts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.starts
+}
+
+func TestRestartOnFailure(t *testing.T) {
+	sm := NewServiceManager(WithLogger(utils.NopLogger{}))
+
+	r := &recorder{}
+	flaky := &flakyService{testService: testService{name: "flaky", recorder: r}, failures: 3}
+
+	require.NoError(t, sm.AddService("flaky", flaky, Restart(RestartPolicy{
+		Mode:           RestartOnFailure,
+		InitialBackoff: time.Millisecond,
+	})))
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error)
+
+	go func() {
+		done <- sm.StartAllAndWait(ctx)
+	}()
+
+	assert.Eventually(t, func() bool {
+		state, _ := sm.State("flaky")
+		return state == StateReady && flaky.getStarts() == 4
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestRestartLimits(t *testing.T) {
+	sm := NewServiceManager(WithLogger(utils.NopLogger{}))
+
+	r := &recorder{}
+	limited := &flakyService{testService: testService{name: "limited", recorder: r}, failures: 100}
+	looping := &flakyService{testService: testService{name: "looping", recorder: r}, failures: 100}
+
+	require.NoError(t, sm.AddService("limited", limited, Critical(false), Restart(RestartPolicy{
+		Mode:           RestartOnFailure,
+		MaxRestarts:    2,
+		InitialBackoff: time.Millisecond,
+	})))
+
+	require.NoError(t, sm.AddService("looping", looping, Restart(RestartPolicy{
+		Mode:              RestartAlways,
+		InitialBackoff:    time.Millisecond,
+		CrashLoopRestarts: 5,
+		CrashLoopWindow:   time.Minute,
+	})))
+
+	// The critical crash looping service takes everything down
+	err := sm.StartAllAndWait(context.Background())
+	assert.ErrorContains(t, err, "flaky")
+
+	assert.Equal(t, 3, limited.getStarts())
+	assert.Equal(t, 6, looping.getStarts())
+}
+
+// exitingService returns from Start straight away without an error.
+type exitingService struct {
+	testService
+}
+
+func (s *exitingService) Start(ctx context.Context) error {
+	s.recorder.add("start " + s.name)
+	return nil
+}
+
+func TestStartReturnsWithoutError(t *testing.T) {
+	sm := NewServiceManager(WithLogger(utils.NopLogger{}))
+
+	r := &recorder{}
+
+	require.NoError(t, sm.AddService("once", &exitingService{testService{name: "once", recorder: r}}))
+	require.NoError(t, sm.AddService("job", &exitingService{testService{name: "job", recorder: r}}, Restart(RestartPolicy{
+		Mode:           RestartOnFailure,
+		InitialBackoff: time.Millisecond,
+	})))
+	require.NoError(t, sm.AddService("api", &testService{name: "api", recorder: r}))
+
+	events, unsubscribe := sm.Subscribe(100)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error)
+
+	go func() {
+		done <- sm.StartAllAndWait(ctx)
+	}()
+
+	// Services whose Start returned are reported as stopped, and the others keep running
+	assert.Eventually(t, func() bool {
+		once, _ := sm.State("once")
+		job, _ := sm.State("job")
+		api, _ := sm.State("api")
+
+		return once == StateStopped && job == StateStopped && api == StateReady
+	}, time.Second, time.Millisecond)
+
+	// Stop is still called for a service that has exited
+	require.NoError(t, sm.StopService(context.Background(), "job"))
+	assert.Contains(t, r.get(), "stop job")
+
+	err := sm.StopService(context.Background(), "job")
+	assert.ErrorContains(t, err, "not running")
+
+	cancel()
+	require.NoError(t, <-done)
+
+	unsubscribe()
+
+	var transitions []string
+
+	for e := range events {
+		if e.Service == "once" {
+			transitions = append(transitions, e.From.String()+" -> "+e.To.String())
+		}
+	}
+
+	assert.Equal(t, []string{
+		"registered -> initializing",
+		"initializing -> initialized",
+		"initialized -> starting",
+		"starting -> ready",
+		"ready -> stopped",
+		"stopped -> stopping",
+		"stopping -> stopped",
+	}, transitions)
+
+	assert.Contains(t, r.get(), "stop once")
+
+	// RestartOnFailure does not restart a service that returned without an error
+	starts := 0
+
+	for _, event := range r.get() {
+		if event == "start job" {
+			starts++
+		}
+	}
+
+	assert.Equal(t, 1, starts)
+}
+
+func TestNonCriticalFailure(t *testing.T) {
+	sm := NewServiceManager(WithLogger(utils.NopLogger{}))
+
+	r := &recorder{}
+
+	require.NoError(t, sm.AddService("metrics", &testService{name: "metrics", recorder: r, startErr: errors.New("failed")}, Critical(false)))
+	require.NoError(t, sm.AddService("api", &testService{name: "api", recorder: r}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error)
+
+	go func() {
+		done <- sm.StartAllAndWait(ctx)
+	}()
+
+	assert.Eventually(t, func() bool {
+		state, _ := sm.State("metrics")
+		return state == StateFailed
+	}, time.Second, time.Millisecond)
+
+	state, err := sm.State("api")
+	require.NoError(t, err)
+	assert.Equal(t, StateReady, state)
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestLoggerPrefixesServiceName(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	sm := NewServiceManager(WithSlogLogger(logger), WithShutdownSignals())
+
+	require.NoError(t, sm.AddService("svc", &testService{name: "svc", recorder: &recorder{}, startErr: errors.New("boom")}))
+
+	err := sm.StartAllAndWait(context.Background())
+	require.Error(t, err)
+
+	assert.Contains(t, buf.String(), `"[svc] Starting service..."`)
+	assert.Contains(t, buf.String(), `"[svc] Service failed: boom"`)
+}
@@ -0,0 +1,75 @@
+package servicemanager
+
+import (
+	"fmt"
+	"time"
+)
+
+// ServiceState is the lifecycle state of a service managed by a ServiceManager.
+type ServiceState int32
+
+const (
+	StateRegistered   ServiceState = iota // Added but not yet initialised
+	StateInitializing                     // Init is running
+	StateInitialized                      // Init has completed
+	StateStarting                         // Start has been called but the service is not ready yet
+	StateReady                            // The service is serving
+	StateStopping                         // Stop is running
+	StateStopped                          // The service has stopped
+	StateFailed                           // Init, Start or Stop returned an error
+	StateRestarting                       // Waiting to restart after Start returned
+)
+
+func (s ServiceState) String() string {
+	switch s {
+	case StateRegistered:
+		return "registered"
+	case StateInitializing:
+		return "initializing"
+	case StateInitialized:
+		return "initialized"
+	case StateStarting:
+		return "starting"
+	case StateReady:
+		return "ready"
+	case StateStopping:
+		return "stopping"
+	case StateStopped:
+		return "stopped"
+	case StateFailed:
+		return "failed"
+	case StateRestarting:
+		return "restarting"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText encodes the state as its name.
+func (s ServiceState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a state name.
+func (s *ServiceState) UnmarshalText(text []byte) error {
+	for state := StateRegistered; state <= StateRestarting; state++ {
+		if state.String() == string(text) {
+			*s = state
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown service state %q", text)
+}
+
+// ServiceStatus is a snapshot of the status of a service.
+type ServiceStatus struct {
+	Name      string       `json:"name"`
+	State     ServiceState `json:"state"`
+	Since     time.Time    `json:"since"`               // When the service entered its current state
+	StartTime time.Time    `json:"startTime"`           // When Start was last called
+	LastError string       `json:"lastError,omitempty"` // The last error returned by Init, Start or Stop
+	Restarts  int          `json:"restarts"`
+	Critical  bool         `json:"critical"`
+	DependsOn []string     `json:"dependsOn,omitempty"`
+}
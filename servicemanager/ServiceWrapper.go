@@ -0,0 +1,259 @@
+package servicemanager
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ordishs/go-utils"
+)
+
+type serviceWrapper struct {
+	name          string
+	instance      Service
+	dependsOn     []string
+	initTimeout   time.Duration
+	stopTimeout   time.Duration
+	restartPolicy RestartPolicy
+	critical      bool
+	mu            sync.RWMutex
+	restarts      int
+	ready         chan struct{}
+	isReady       bool
+	running       bool               // Init or Start is in progress
+	exited        bool               // Start returned without an error and Stop has not been called yet
+	cancel        context.CancelFunc // Cancels the context passed to Start
+	done          chan struct{}      // Closed when the Start goroutine has exited
+	state         ServiceState
+	stateTime     time.Time
+	startTime     time.Time
+	err           error
+	onTransition  func(e Event)
+	logger        utils.Logger // Prefixes messages with the service name
+	clock         Clock
+}
+
+func newServiceWrapper(name string, service Service, clock Clock) *serviceWrapper {
+	return &serviceWrapper{
+		name:      name,
+		instance:  service,
+		critical:  true,
+		logger:    utils.NopLogger{},
+		ready:     make(chan struct{}),
+		stateTime: clock.Now(),
+		clock:     clock,
+	}
+}
+
+func (s *serviceWrapper) setState(state ServiceState, err error) {
+	s.mu.Lock()
+	e := s.setStateLocked(state, err)
+	s.mu.Unlock()
+
+	s.notify(e)
+}
+
+// setStateLocked changes the state and returns the corresponding event, which must be
+// passed to notify once the lock has been released. The caller must hold s.mu.
+func (s *serviceWrapper) setStateLocked(state ServiceState, err error) Event {
+	e := Event{
+		Service: s.name,
+		From:    s.state,
+		To:      state,
+		Time:    s.clock.Now(),
+		Err:     err,
+	}
+
+	s.state = state
+	s.stateTime = e.Time
+
+	if state == StateStarting {
+		s.startTime = s.stateTime
+	}
+
+	if err != nil {
+		s.err = err
+	}
+
+	return e
+}
+
+func (s *serviceWrapper) notify(e Event) {
+	if s.onTransition != nil && (e.From != e.To || e.Err != nil) {
+		s.onTransition(e)
+	}
+}
+
+func (s *serviceWrapper) status() ServiceStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	status := ServiceStatus{
+		Name:      s.name,
+		State:     s.state,
+		Since:     s.stateTime,
+		StartTime: s.startTime,
+		Restarts:  s.restarts,
+		Critical:  s.critical,
+		DependsOn: slices.Clone(s.dependsOn),
+	}
+
+	if s.err != nil {
+		status.LastError = s.err.Error()
+	}
+
+	return status
+}
+
+func (s *serviceWrapper) getState() ServiceState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.state
+}
+
+// isActive reports whether the service has been started and has not stopped or failed.
+func (s *serviceWrapper) isActive() bool {
+	switch s.getState() {
+	case StateRegistered, StateStopped, StateFailed:
+		return false
+	default:
+		return true
+	}
+}
+
+func (s *serviceWrapper) restartCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.restarts
+}
+
+func (s *serviceWrapper) addRestart() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.restarts++
+}
+
+// markReady is called when the service announces it is ready, or straight after Start
+// is called for services that do not signal readiness themselves.
+func (s *serviceWrapper) markReady() {
+	s.mu.Lock()
+
+	var e Event
+
+	if s.state == StateStarting {
+		e = s.setStateLocked(StateReady, nil)
+	}
+
+	if !s.isReady {
+		s.isReady = true
+		close(s.ready)
+	}
+
+	s.mu.Unlock()
+
+	s.notify(e)
+}
+
+func (s *serviceWrapper) readyChan() <-chan struct{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.ready
+}
+
+// resetReady prepares a stopped service to signal readiness again.
+func (s *serviceWrapper) resetReady() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.isReady {
+		s.isReady = false
+		s.ready = make(chan struct{})
+	}
+}
+
+// setRunning marks the service as being initialised or started. It returns false
+// if the service was already running.
+func (s *serviceWrapper) setRunning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running {
+		return false
+	}
+
+	s.running = true
+
+	return true
+}
+
+func (s *serviceWrapper) clearRunning() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.running = false
+	s.cancel = nil
+}
+
+func (s *serviceWrapper) setRun(cancel context.CancelFunc, done chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cancel = cancel
+	s.done = done
+}
+
+func (s *serviceWrapper) getRun() (context.CancelFunc, chan struct{}) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.cancel, s.done
+}
+
+// markExited moves a service whose Start returned without an error, and that is not
+// restarted, to the stopped state. Stop is still called when the service is stopped.
+func (s *serviceWrapper) markExited() {
+	s.mu.Lock()
+	s.exited = true
+	e := s.setStateLocked(StateStopped, nil)
+	s.mu.Unlock()
+
+	s.notify(e)
+}
+
+// hasExited reports whether Start returned without an error and Stop has not been called yet.
+func (s *serviceWrapper) hasExited() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.exited
+}
+
+// beginStop moves the service to the stopping state. It returns false if the service
+// was never started or is already stopping or stopped, and whether it had failed.
+// A service whose Start has exited is still stopped, so that Stop is called.
+func (s *serviceWrapper) beginStop() (ok bool, failed bool) {
+	s.mu.Lock()
+
+	switch {
+	case s.state == StateRegistered, s.state == StateStopping, s.state == StateStopped && !s.exited:
+		s.mu.Unlock()
+		return false, false
+	}
+
+	s.exited = false
+
+	failed = s.state == StateFailed
+
+	e := s.setStateLocked(StateStopping, nil)
+
+	s.mu.Unlock()
+
+	s.notify(e)
+
+	return true, failed
+}
@@ -0,0 +1,175 @@
+package servicemanager
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultStopTimeout = 10 * time.Second
+
+// stopServices stops the given services, which must be sorted in dependency order,
+// so that every service is stopped before the services it depends on.
+// It returns the names of the services that failed to stop, or that had not stopped
+// when the shutdown timeout expired.
+func (sm *ServiceManager) stopServices(services []*serviceWrapper) []string {
+	var (
+		mu      sync.Mutex
+		stopped = make(map[string]bool, len(services))
+		failed  []string
+	)
+
+	stop := func(s *serviceWrapper) {
+		err := sm.stopService(s)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if err == nil {
+			stopped[s.name] = true
+		} else {
+			failed = append(failed, s.name)
+		}
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		if sm.parallelStop {
+			stopInParallel(services, stop)
+		} else {
+			for i := len(services) - 1; i >= 0; i-- {
+				stop(services[i])
+			}
+		}
+	}()
+
+	var deadline <-chan time.Time
+
+	if sm.shutdownTimeout > 0 {
+		timer := sm.clock.NewTimer(sm.shutdownTimeout)
+		defer timer.Stop()
+
+		deadline = timer.C()
+	}
+
+	select {
+	case <-done:
+		mu.Lock()
+		defer mu.Unlock()
+
+		return failed
+
+	case <-deadline:
+		mu.Lock()
+		defer mu.Unlock()
+
+		var pending []string
+
+		for _, s := range services {
+			if !stopped[s.name] {
+				pending = append(pending, s.name)
+			}
+		}
+
+		sm.logger.Errorf("Shutdown did not complete within %s. Services not stopped: %s", sm.shutdownTimeout, strings.Join(pending, ", "))
+		sm.exit(1)
+
+		return pending
+	}
+}
+
+// stopInParallel calls stop for every service concurrently, waiting for all the services
+// that depend on a service to be stopped before stopping it.
+func stopInParallel(services []*serviceWrapper, stop func(s *serviceWrapper)) {
+	done := make(map[string]chan struct{}, len(services))
+	for _, s := range services {
+		done[s.name] = make(chan struct{})
+	}
+
+	var wg sync.WaitGroup
+
+	for _, service := range services {
+		s := service
+
+		var dependents []chan struct{}
+
+		for _, other := range services {
+			for _, dep := range other.dependsOn {
+				if dep == s.name {
+					dependents = append(dependents, done[other.name])
+				}
+			}
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			defer close(done[s.name])
+
+			for _, ch := range dependents {
+				<-ch
+			}
+
+			stop(s)
+		}()
+	}
+
+	wg.Wait()
+}
+
+// stopService calls Stop on the service and waits for it to return or for the stop
+// timeout to expire. Services that were never started, or are already stopping or
+// stopped, are skipped.
+func (sm *ServiceManager) stopService(s *serviceWrapper) error {
+	ok, failed := s.beginStop()
+	if !ok {
+		return nil
+	}
+
+	timeout := s.stopTimeout
+	if timeout == 0 {
+		timeout = sm.stopTimeout
+	}
+
+	stopCtx, stopCancel := withClockTimeout(context.Background(), s.clock, timeout)
+	defer stopCancel()
+
+	s.logger.Infof("Stopping service...")
+
+	result := make(chan error, 1)
+
+	go func() {
+		result <- s.instance.Stop(stopCtx)
+	}()
+
+	var err error
+
+	select {
+	case err = <-result:
+	case <-stopCtx.Done():
+		err = fmt.Errorf("did not stop within %s", timeout)
+	}
+
+	if err != nil {
+		s.logger.Warnf("Failed to stop service: %v", err)
+		s.setState(StateFailed, err)
+
+		return err
+	}
+
+	s.logger.Infof("Service stopped gracefully")
+
+	if failed {
+		s.setState(StateFailed, nil)
+	} else {
+		s.setState(StateStopped, nil)
+	}
+
+	return nil
+}
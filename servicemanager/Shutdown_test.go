@@ -0,0 +1,108 @@
+package servicemanager_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ordishs/go-utils"
+	"github.com/ordishs/go-utils/servicemanager"
+	"github.com/ordishs/go-utils/servicemanager/smtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStopTimeouts(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	clock := smtest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	rec := smtest.NewRecorder()
+	errFailed := errors.New("failed")
+
+	sm := servicemanager.NewServiceManager(servicemanager.WithLogger(utils.NopLogger{}), servicemanager.WithClock(clock), servicemanager.WithStopTimeout(time.Second))
+
+	require.NoError(t, sm.AddService("hung", smtest.NewFakeService("hung", rec).WithClock(clock).ScriptStop(smtest.Result{Delay: time.Hour}), servicemanager.StopTimeout(20*time.Millisecond)))
+	require.NoError(t, sm.AddService("slow", smtest.NewFakeService("slow", rec).WithClock(clock).ScriptStop(smtest.Result{Delay: 50 * time.Millisecond})))
+	require.NoError(t, sm.AddService("failing", smtest.NewFakeService("failing", rec).ScriptStart(smtest.Result{Err: errFailed})))
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- sm.StartAllAndWait(ctx)
+	}()
+
+	// The stop timeout and the delay of slow
+	require.NoError(t, rec.WaitFor(ctx, "stop slow"))
+	require.NoError(t, clock.WaitForTimers(ctx, 2))
+
+	clock.Advance(50 * time.Millisecond)
+
+	// The stop timeout and the delay of hung
+	require.NoError(t, rec.WaitFor(ctx, "stop hung"))
+	require.NoError(t, clock.WaitForTimers(ctx, 2))
+
+	clock.Advance(20 * time.Millisecond)
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, errFailed)
+	case <-ctx.Done():
+		t.Fatal("StartAllAndWait did not return")
+	}
+
+	smtest.AssertOrder(t, rec, "stop failing", "stop slow", "stop hung")
+
+	state, err := sm.State("hung")
+	require.NoError(t, err)
+	assert.Equal(t, servicemanager.StateFailed, state)
+
+	state, err = sm.State("slow")
+	require.NoError(t, err)
+	assert.Equal(t, servicemanager.StateStopped, state)
+}
+
+func TestParallelStop(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	clock := smtest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	rec := smtest.NewRecorder()
+	errFailed := errors.New("failed")
+
+	sm := servicemanager.NewServiceManager(servicemanager.WithLogger(utils.NopLogger{}), servicemanager.WithClock(clock), servicemanager.WithParallelStop())
+
+	require.NoError(t, sm.AddService("db", smtest.NewFakeService("db", rec)))
+	require.NoError(t, sm.AddService("a", smtest.NewFakeService("a", rec).WithClock(clock).ScriptStop(smtest.Result{Delay: 100 * time.Millisecond}), servicemanager.DependsOn("db")))
+	require.NoError(t, sm.AddService("b", smtest.NewFakeService("b", rec).WithClock(clock).ScriptStart(smtest.Result{Err: errFailed}).ScriptStop(smtest.Result{Delay: 100 * time.Millisecond}), servicemanager.DependsOn("db")))
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- sm.StartAllAndWait(ctx)
+	}()
+
+	// a and b are stopped concurrently, so both are stopping before the clock moves
+	require.NoError(t, rec.WaitFor(ctx, "stop a"))
+	require.NoError(t, rec.WaitFor(ctx, "stop b"))
+
+	// The stop timeouts and the delays of a and b
+	require.NoError(t, clock.WaitForTimers(ctx, 4))
+	smtest.AssertNotRecorded(t, rec, "stop db")
+
+	clock.Advance(100 * time.Millisecond)
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, errFailed)
+	case <-ctx.Done():
+		t.Fatal("StartAllAndWait did not return")
+	}
+
+	smtest.AssertBefore(t, rec, "stop a", "stop db")
+	smtest.AssertBefore(t, rec, "stop b", "stop db")
+
+	events := rec.Events()
+	assert.Equal(t, "stop db", events[len(events)-1])
+}
@@ -0,0 +1,113 @@
+package servicemanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// handleSignals listens for the configured shutdown and reload signals until the
+// returned function is called. The first shutdown signal calls cancel, and any
+// shutdown signal received after shutdown has begun exits the process immediately.
+func (sm *ServiceManager) handleSignals(ctx context.Context, cancel context.CancelFunc) func() {
+	handled := append(append([]os.Signal{}, sm.shutdownSignals...), sm.reloadSignals...)
+	if len(handled) == 0 {
+		// signal.Notify with no signals would relay every signal
+		return func() {}
+	}
+
+	sigs := make(chan os.Signal, 1)
+	sm.signals.Notify(sigs, handled...)
+
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		for {
+			select {
+			case <-done:
+				return
+
+			case sig := <-sigs:
+				if containsSignal(sm.reloadSignals, sig) {
+					sm.logger.Infof("Received %s signal. Reloading services...", sig)
+
+					go func() {
+						if err := sm.ReloadAll(ctx); err != nil {
+							sm.logger.Errorf("Failed to reload services: %v", err)
+						}
+					}()
+
+					continue
+				}
+
+				if ctx.Err() != nil {
+					sm.logger.Errorf("Received second %s signal. Forcing exit...", sig)
+					sm.exit(1)
+
+					return
+				}
+
+				sm.logger.Infof("Received %s signal. Stopping services...", sig)
+				cancel()
+			}
+		}
+	}()
+
+	return func() {
+		sm.signals.Stop(sigs)
+		close(done)
+		wg.Wait()
+	}
+}
+
+func containsSignal(sigs []os.Signal, sig os.Signal) bool {
+	for _, s := range sigs {
+		if s == sig {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ReloadAll calls Reload on every running service that implements Reloadable,
+// in dependency order. All services are reloaded even if some of them fail,
+// and the errors are returned together.
+func (sm *ServiceManager) ReloadAll(ctx context.Context) error {
+	sm.reloadMu.Lock()
+	defer sm.reloadMu.Unlock()
+
+	sm.mu.RLock()
+	services, err := sm.sortServices()
+	sm.mu.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+
+	for _, s := range services {
+		r, ok := s.instance.(Reloadable)
+		if !ok || s.getState() != StateReady {
+			continue
+		}
+
+		s.logger.Infof("Reloading service...")
+
+		if err := r.Reload(ctx); err != nil {
+			s.logger.Errorf("Failed to reload service: %v", err)
+			errs = append(errs, fmt.Errorf("[%s] %w", s.name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
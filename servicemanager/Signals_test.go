@@ -0,0 +1,86 @@
+package servicemanager_test
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ordishs/go-utils"
+	"github.com/ordishs/go-utils/servicemanager"
+	"github.com/ordishs/go-utils/servicemanager/smtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type reloadableService struct {
+	*smtest.FakeService
+	recorder *smtest.Recorder
+}
+
+func (s *reloadableService) Reload(ctx context.Context) error {
+	s.recorder.Record("reload " + s.Name())
+	return nil
+}
+
+func TestSignals(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	clock := smtest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	signals := smtest.NewFakeSignals()
+	exit := smtest.NewExitRecorder()
+	rec := smtest.NewRecorder()
+
+	sm := servicemanager.NewServiceManager(
+		servicemanager.WithLogger(utils.NopLogger{}),
+		servicemanager.WithClock(clock),
+		servicemanager.WithSignalNotifier(signals),
+		servicemanager.WithExitFunc(exit.Exit),
+		servicemanager.WithShutdownSignals(syscall.SIGTERM),
+		servicemanager.WithReloadSignals(syscall.SIGHUP),
+	)
+
+	require.NoError(t, sm.AddService("config", &reloadableService{FakeService: smtest.NewFakeService("config", rec), recorder: rec}))
+	require.NoError(t, sm.AddService("slow", smtest.NewFakeService("slow", rec).WithClock(clock).ScriptStop(smtest.Result{Delay: 200 * time.Millisecond})))
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- sm.StartAllAndWait(ctx)
+	}()
+
+	require.NoError(t, sm.WaitReady(ctx))
+
+	require.NoError(t, signals.WaitForSubscriber(ctx, syscall.SIGHUP))
+	assert.Equal(t, 1, signals.Send(syscall.SIGHUP))
+	require.NoError(t, rec.WaitFor(ctx, "reload config"))
+
+	// The first signal stops the services, the second one forces an exit
+	require.NoError(t, signals.WaitForSubscriber(ctx, syscall.SIGTERM))
+	assert.Equal(t, 1, signals.Send(syscall.SIGTERM))
+	require.NoError(t, rec.WaitFor(ctx, "stop slow"))
+
+	state, err := sm.State("slow")
+	require.NoError(t, err)
+	assert.Equal(t, servicemanager.StateStopping, state)
+
+	assert.Equal(t, 1, signals.Send(syscall.SIGTERM))
+
+	code, err := exit.Wait(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, code)
+
+	// The stop timeout and the delay of slow
+	require.NoError(t, clock.WaitForTimers(ctx, 2))
+	clock.Advance(200 * time.Millisecond)
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-ctx.Done():
+		t.Fatal("StartAllAndWait did not return")
+	}
+
+	smtest.AssertOrder(t, rec, "reload config", "stop slow", "stop config")
+}
@@ -73,9 +73,17 @@ func main() {
 	serviceManager := servicemanager.NewServiceManager()
 
 	// Add services to the service manager
-	serviceManager.AddService("ServiceA", NewService("SvcA"))
-	serviceManager.AddService("ServiceB", NewService("SvcB"))
-	serviceManager.AddService("ServiceC", NewService("SvcC"))
+	if err := serviceManager.AddService("ServiceA", NewService("SvcA")); err != nil {
+		logger.Fatalf("Failed to add ServiceA: %v", err)
+	}
+
+	if err := serviceManager.AddService("ServiceB", NewService("SvcB")); err != nil {
+		logger.Fatalf("Failed to add ServiceB: %v", err)
+	}
+
+	if err := serviceManager.AddService("ServiceC", NewService("SvcC")); err != nil {
+		logger.Fatalf("Failed to add ServiceC: %v", err)
+	}
 
 	// Creating a root context for the application
 	rootCtx, cancel := context.WithCancel(context.Background())
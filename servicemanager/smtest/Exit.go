@@ -0,0 +1,37 @@
+package smtest
+
+import (
+	"context"
+	"fmt"
+)
+
+// ExitRecorder captures exit codes instead of exiting the process.
+// Pass its Exit method to servicemanager.WithExitFunc.
+type ExitRecorder struct {
+	codes chan int
+}
+
+// NewExitRecorder creates an ExitRecorder.
+func NewExitRecorder() *ExitRecorder {
+	return &ExitRecorder{
+		codes: make(chan int, 16),
+	}
+}
+
+// Exit records code.
+func (e *ExitRecorder) Exit(code int) {
+	select {
+	case e.codes <- code:
+	default:
+	}
+}
+
+// Wait returns the next recorded exit code, or an error if ctx is done first.
+func (e *ExitRecorder) Wait(ctx context.Context) (int, error) {
+	select {
+	case code := <-e.codes:
+		return code, nil
+	case <-ctx.Done():
+		return 0, fmt.Errorf("exit was not called: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,193 @@
+package smtest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ordishs/go-utils/servicemanager"
+)
+
+// Result scripts the outcome of one call to Init, Start or Stop: the call waits for
+// Delay and then returns Err.
+type Result struct {
+	Err   error
+	Delay time.Duration
+}
+
+// FakeService is a servicemanager.Service whose behaviour is scripted per call.
+// Each call to Init, Start and Stop records "init <name>", "start <name>" or
+// "stop <name>" with the Recorder and then plays the next scripted Result for
+// that method.
+//
+// When the script for a method is exhausted, Init and Stop return nil straight
+// away and Start runs until its context is cancelled. A Start call that is
+// cancelled during its Delay returns nil, while Init and Stop return the context
+// error.
+type FakeService struct {
+	name     string
+	recorder *Recorder
+	clock    servicemanager.Clock
+
+	mu    sync.Mutex
+	init  []Result
+	start []Result
+	stop  []Result
+	calls map[string]int
+}
+
+// NewFakeService creates a FakeService that records its calls with recorder.
+// If recorder is nil, calls are not recorded.
+func NewFakeService(name string, recorder *Recorder) *FakeService {
+	return &FakeService{
+		name:     name,
+		recorder: recorder,
+		clock:    servicemanager.SystemClock(),
+		calls:    make(map[string]int),
+	}
+}
+
+// WithClock makes the scripted delays wait on clock, typically a FakeClock shared
+// with the ServiceManager.
+func (f *FakeService) WithClock(clock servicemanager.Clock) *FakeService {
+	f.clock = clock
+	return f
+}
+
+// ScriptInit sets the results of successive calls to Init.
+func (f *FakeService) ScriptInit(results ...Result) *FakeService {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.init = results
+
+	return f
+}
+
+// ScriptStart sets the results of successive calls to Start.
+func (f *FakeService) ScriptStart(results ...Result) *FakeService {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.start = results
+
+	return f
+}
+
+// ScriptStop sets the results of successive calls to Stop.
+func (f *FakeService) ScriptStop(results ...Result) *FakeService {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.stop = results
+
+	return f
+}
+
+// Name returns the name of the service.
+func (f *FakeService) Name() string {
+	return f.name
+}
+
+// InitCalls returns the number of times Init was called.
+func (f *FakeService) InitCalls() int {
+	return f.count("init")
+}
+
+// StartCalls returns the number of times Start was called.
+func (f *FakeService) StartCalls() int {
+	return f.count("start")
+}
+
+// StopCalls returns the number of times Stop was called.
+func (f *FakeService) StopCalls() int {
+	return f.count("stop")
+}
+
+func (f *FakeService) Init(ctx context.Context) error {
+	result, ok := f.next("init", &f.init)
+	if !ok {
+		return nil
+	}
+
+	if err := f.wait(ctx, result.Delay); err != nil {
+		return err
+	}
+
+	return result.Err
+}
+
+func (f *FakeService) Start(ctx context.Context) error {
+	result, ok := f.next("start", &f.start)
+	if !ok {
+		<-ctx.Done()
+		return nil
+	}
+
+	if err := f.wait(ctx, result.Delay); err != nil {
+		return nil
+	}
+
+	return result.Err
+}
+
+func (f *FakeService) Stop(ctx context.Context) error {
+	result, ok := f.next("stop", &f.stop)
+	if !ok {
+		return nil
+	}
+
+	if err := f.wait(ctx, result.Delay); err != nil {
+		return err
+	}
+
+	return result.Err
+}
+
+// next records the call and pops the next scripted result for method.
+func (f *FakeService) next(method string, script *[]Result) (Result, bool) {
+	f.mu.Lock()
+
+	f.calls[method]++
+
+	var (
+		result Result
+		ok     bool
+	)
+
+	if len(*script) > 0 {
+		result, ok = (*script)[0], true
+		*script = (*script)[1:]
+	}
+
+	f.mu.Unlock()
+
+	if f.recorder != nil {
+		f.recorder.Record(method + " " + f.name)
+	}
+
+	return result, ok
+}
+
+func (f *FakeService) count(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.calls[method]
+}
+
+func (f *FakeService) wait(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := f.clock.NewTimer(delay)
+
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		timer.Stop()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,132 @@
+package smtest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// FakeSignals is a servicemanager.SignalNotifier that delivers signals sent with
+// Send instead of OS signals. It is safe for concurrent use.
+type FakeSignals struct {
+	mu            sync.Mutex
+	subscriptions []*signalSubscription
+	changed       chan struct{}
+}
+
+type signalSubscription struct {
+	c       chan<- os.Signal
+	sigs    []os.Signal
+	stopped chan struct{}
+}
+
+// NewFakeSignals creates a FakeSignals without subscribers.
+func NewFakeSignals() *FakeSignals {
+	return &FakeSignals{
+		changed: make(chan struct{}),
+	}
+}
+
+// Notify relays the given signals to c. Unlike signal.Notify, calling it without
+// signals relays nothing.
+func (f *FakeSignals) Notify(c chan<- os.Signal, sigs ...os.Signal) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.subscriptions = append(f.subscriptions, &signalSubscription{
+		c:       c,
+		sigs:    append([]os.Signal{}, sigs...),
+		stopped: make(chan struct{}),
+	})
+
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// Stop stops relaying signals to c.
+func (f *FakeSignals) Stop(c chan<- os.Signal) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	remaining := f.subscriptions[:0]
+
+	for _, s := range f.subscriptions {
+		if s.c == c {
+			close(s.stopped)
+		} else {
+			remaining = append(remaining, s)
+		}
+	}
+
+	f.subscriptions = remaining
+}
+
+// Send delivers sig to every channel subscribed to it and returns the number of
+// channels it was delivered to. Unlike OS signals, Send waits until each channel
+// has accepted the signal or has been stopped, so signals are never dropped.
+func (f *FakeSignals) Send(sig os.Signal) int {
+	f.mu.Lock()
+
+	var targets []*signalSubscription
+
+	for _, s := range f.subscriptions {
+		if s.handles(sig) {
+			targets = append(targets, s)
+		}
+	}
+
+	f.mu.Unlock()
+
+	delivered := 0
+
+	for _, s := range targets {
+		select {
+		case s.c <- sig:
+			delivered++
+		case <-s.stopped:
+		}
+	}
+
+	return delivered
+}
+
+// WaitForSubscriber blocks until a channel is subscribed to sig or ctx is done.
+// Use it before Send to make sure the ServiceManager is listening.
+func (f *FakeSignals) WaitForSubscriber(ctx context.Context, sig os.Signal) error {
+	for {
+		f.mu.Lock()
+
+		found := false
+
+		for _, s := range f.subscriptions {
+			if s.handles(sig) {
+				found = true
+				break
+			}
+		}
+
+		changed := f.changed
+		f.mu.Unlock()
+
+		if found {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return fmt.Errorf("no subscriber for %s signal: %w", sig, ctx.Err())
+		}
+	}
+}
+
+func (s *signalSubscription) handles(sig os.Signal) bool {
+	for _, other := range s.sigs {
+		if other == sig {
+			return true
+		}
+	}
+
+	return false
+}
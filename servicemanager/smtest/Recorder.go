@@ -0,0 +1,162 @@
+// Package smtest provides fakes and assertion helpers for testing Service
+// implementations and code that uses a servicemanager.ServiceManager.
+package smtest
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// Recorder records lifecycle events such as "init a", "start a" and "stop a" in
+// the order in which they happened. It is safe for concurrent use.
+type Recorder struct {
+	mu      sync.Mutex
+	events  []string
+	changed chan struct{}
+}
+
+// NewRecorder creates an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{
+		changed: make(chan struct{}),
+	}
+}
+
+// Record appends an event.
+func (r *Recorder) Record(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, event)
+
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// Events returns a copy of the recorded events.
+func (r *Recorder) Events() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string{}, r.events...)
+}
+
+// Reset removes all recorded events.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = nil
+}
+
+// WaitFor blocks until event has been recorded or ctx is done.
+func (r *Recorder) WaitFor(ctx context.Context, event string) error {
+	return r.WaitForCount(ctx, event, 1)
+}
+
+// WaitForCount blocks until event has been recorded at least n times or ctx is done.
+func (r *Recorder) WaitForCount(ctx context.Context, event string, n int) error {
+	for {
+		r.mu.Lock()
+		count := countOf(r.events, event)
+		changed := r.changed
+		r.mu.Unlock()
+
+		if count >= n {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return fmt.Errorf("event %q was recorded %d of %d times: %w", event, count, n, ctx.Err())
+		}
+	}
+}
+
+// AssertEvents checks that exactly the given events were recorded, in that order.
+func AssertEvents(t testing.TB, r *Recorder, events ...string) bool {
+	t.Helper()
+
+	got := r.Events()
+
+	if !slices.Equal(got, events) {
+		t.Errorf("unexpected events\nexpected: %q\n  actual: %q", events, got)
+		return false
+	}
+
+	return true
+}
+
+// AssertOrder checks that the given events were recorded in that order. Other
+// events may have been recorded before, between or after them.
+func AssertOrder(t testing.TB, r *Recorder, events ...string) bool {
+	t.Helper()
+
+	got := r.Events()
+	from := 0
+
+	for _, event := range events {
+		i := indexOf(got, event, from)
+		if i < 0 {
+			if indexOf(got, event, 0) < 0 {
+				t.Errorf("event %q was not recorded\nevents: %q", event, got)
+			} else {
+				t.Errorf("event %q was recorded out of order\nexpected order: %q\n        events: %q", event, events, got)
+			}
+
+			return false
+		}
+
+		from = i + 1
+	}
+
+	return true
+}
+
+// AssertBefore checks that first and second were both recorded, and that first
+// was recorded before second.
+func AssertBefore(t testing.TB, r *Recorder, first string, second string) bool {
+	t.Helper()
+
+	return AssertOrder(t, r, first, second)
+}
+
+// AssertNotRecorded checks that event was not recorded.
+func AssertNotRecorded(t testing.TB, r *Recorder, event string) bool {
+	t.Helper()
+
+	got := r.Events()
+
+	if indexOf(got, event, 0) >= 0 {
+		t.Errorf("event %q should not have been recorded\nevents: %q", event, got)
+		return false
+	}
+
+	return true
+}
+
+func indexOf(events []string, event string, from int) int {
+	for i := from; i < len(events); i++ {
+		if events[i] == event {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func countOf(events []string, event string) int {
+	n := 0
+
+	for _, e := range events {
+		if e == event {
+			n++
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,221 @@
+package smtest
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ordishs/go-utils"
+	"github.com/ordishs/go-utils/servicemanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestManager(clock *FakeClock, signals *FakeSignals, opts ...servicemanager.Option) *servicemanager.ServiceManager {
+	return servicemanager.NewServiceManager(append([]servicemanager.Option{
+		servicemanager.WithLogger(utils.NopLogger{}),
+		servicemanager.WithClock(clock),
+		servicemanager.WithSignalNotifier(signals),
+	}, opts...)...)
+}
+
+func run(sm *servicemanager.ServiceManager) chan error {
+	result := make(chan error, 1)
+
+	go func() {
+		result <- sm.StartAllAndWait(context.Background())
+	}()
+
+	return result
+}
+
+func TestShutdownOnSignal(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	clock := NewFakeClock(time.Unix(0, 0))
+	signals := NewFakeSignals()
+	r := NewRecorder()
+
+	sm := newTestManager(clock, signals)
+
+	require.NoError(t, sm.AddService("db", NewFakeService("db", r)))
+	require.NoError(t, sm.AddService("api", NewFakeService("api", r), servicemanager.DependsOn("db")))
+
+	result := run(sm)
+
+	require.NoError(t, r.WaitFor(ctx, "start api"))
+	require.NoError(t, signals.WaitForSubscriber(ctx, syscall.SIGTERM))
+
+	assert.Equal(t, 1, signals.Send(syscall.SIGTERM))
+	require.NoError(t, <-result)
+
+	AssertOrder(t, r, "init db", "init api", "start db", "start api", "stop api", "stop db")
+	AssertBefore(t, r, "stop api", "stop db")
+}
+
+func TestSecondSignalForcesExit(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	clock := NewFakeClock(time.Unix(0, 0))
+	signals := NewFakeSignals()
+	exit := NewExitRecorder()
+	r := NewRecorder()
+
+	sm := newTestManager(clock, signals, servicemanager.WithExitFunc(exit.Exit))
+
+	// Stop blocks until the clock reaches the stop timeout
+	require.NoError(t, sm.AddService("slow", NewFakeService("slow", r).WithClock(clock).ScriptStop(Result{Delay: time.Hour})))
+
+	result := run(sm)
+
+	require.NoError(t, r.WaitFor(ctx, "start slow"))
+	require.NoError(t, signals.WaitForSubscriber(ctx, syscall.SIGINT))
+
+	signals.Send(syscall.SIGINT)
+	require.NoError(t, r.WaitFor(ctx, "stop slow"))
+	signals.Send(syscall.SIGINT)
+
+	code, err := exit.Wait(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, code)
+
+	// Let the stop timeout expire so that StartAllAndWait returns
+	require.NoError(t, clock.WaitForTimers(ctx, 2))
+	clock.Advance(10 * time.Second)
+
+	require.NoError(t, <-result)
+	assert.Equal(t, servicemanager.StateFailed, mustState(t, sm, "slow"))
+}
+
+func TestRestartBackoffUsesClock(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	clock := NewFakeClock(time.Unix(0, 0))
+	signals := NewFakeSignals()
+	r := NewRecorder()
+
+	sm := newTestManager(clock, signals)
+
+	svc := NewFakeService("flaky", r).ScriptStart(
+		Result{Err: errors.New("first")},
+		Result{Err: errors.New("second")},
+	)
+
+	require.NoError(t, sm.AddService("flaky", svc, servicemanager.Restart(servicemanager.RestartPolicy{
+		Mode:           servicemanager.RestartOnFailure,
+		InitialBackoff: time.Minute,
+	})))
+
+	result := run(sm)
+
+	// First restart after one minute
+	require.NoError(t, clock.WaitForTimers(ctx, 1))
+	assert.Equal(t, 1, svc.StartCalls())
+	clock.Advance(time.Minute)
+
+	// Second restart after two minutes
+	require.NoError(t, clock.WaitForTimers(ctx, 1))
+	clock.Advance(time.Minute)
+	assert.Equal(t, 2, svc.StartCalls())
+	clock.Advance(time.Minute)
+
+	require.NoError(t, r.WaitForCount(ctx, "start flaky", 3))
+	assert.Equal(t, servicemanager.StateReady, mustState(t, sm, "flaky"))
+
+	require.NoError(t, signals.WaitForSubscriber(ctx, syscall.SIGTERM))
+	signals.Send(syscall.SIGTERM)
+	require.NoError(t, <-result)
+
+	AssertEvents(t, r, "init flaky", "start flaky", "start flaky", "start flaky", "stop flaky")
+}
+
+func TestInitTimeoutUsesClock(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	clock := NewFakeClock(time.Unix(0, 0))
+	r := NewRecorder()
+
+	sm := newTestManager(clock, NewFakeSignals(), servicemanager.WithInitTimeout(time.Second))
+
+	require.NoError(t, sm.AddService("a", NewFakeService("a", r).ScriptInit(Result{Delay: time.Hour})))
+	require.NoError(t, sm.AddService("b", NewFakeService("b", r), servicemanager.DependsOn("a")))
+
+	result := run(sm)
+
+	require.NoError(t, r.WaitFor(ctx, "init a"))
+	require.NoError(t, clock.WaitForTimers(ctx, 1))
+	clock.Advance(time.Second)
+
+	err := <-result
+
+	var initErr *servicemanager.InitError
+	require.ErrorAs(t, err, &initErr)
+	assert.ErrorContains(t, initErr.Errors["a"], "did not initialize within 1s")
+
+	AssertEvents(t, r, "init a")
+	AssertNotRecorded(t, r, "start b")
+}
+
+func mustState(t *testing.T, sm *servicemanager.ServiceManager, name string) servicemanager.ServiceState {
+	t.Helper()
+
+	state, err := sm.State(name)
+	require.NoError(t, err)
+
+	return state
+}
+
+func TestFakeClockStoppedTimers(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+
+	stopped := clock.NewTimer(time.Second)
+	fired := clock.NewTimer(time.Second)
+	assert.Equal(t, 2, clock.Timers())
+
+	assert.True(t, stopped.Stop())
+	assert.False(t, stopped.Stop())
+	assert.Equal(t, 1, clock.Timers())
+
+	clock.Advance(time.Second)
+	assert.Equal(t, 0, clock.Timers())
+	assert.False(t, fired.Stop())
+
+	select {
+	case <-fired.C():
+	default:
+		t.Error("the timer did not fire")
+	}
+
+	select {
+	case <-stopped.C():
+		t.Error("a stopped timer fired")
+	default:
+	}
+}
+
+func TestFakeServiceStopsAbandonedTimers(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	svc := NewFakeService("svc", nil).WithClock(clock).ScriptInit(Result{Delay: time.Hour})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- svc.Init(ctx)
+	}()
+
+	require.NoError(t, clock.WaitForTimers(context.Background(), 1))
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	// The delay was abandoned, so it must not satisfy WaitForTimers
+	assert.Equal(t, 0, clock.Timers())
+}
@@ -0,0 +1,55 @@
+package stat
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Gauge holds a value that goes up and down, such as a queue depth, together with
+// the highest value it has reached.
+type Gauge struct {
+	mu    sync.RWMutex
+	value int64
+	max   int64
+}
+
+func NewGauge() *Gauge {
+	return &Gauge{}
+}
+
+func (g *Gauge) Set(value int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.value = value
+	if value > g.max {
+		g.max = value
+	}
+}
+
+func (g *Gauge) Add(delta int64) int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.value += delta
+	if g.value > g.max {
+		g.max = g.value
+	}
+	return g.value
+}
+
+func (g *Gauge) Get() int64 {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.value
+}
+
+func (g *Gauge) GetMax() int64 {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.max
+}
+
+func (g *Gauge) String() string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return fmt.Sprintf("%d (max %d)", g.value, g.max)
+}
@@ -0,0 +1,452 @@
+// Package workerpool provides a pool of goroutines that process tasks from a
+// bounded queue. A Pool implements servicemanager.Service, and drains the queue
+// when it is stopped.
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ordishs/go-utils"
+	"github.com/ordishs/go-utils/stat"
+)
+
+var (
+	// ErrQueueFull is returned by Submit when the queue is full and the policy is Reject.
+	ErrQueueFull = errors.New("workerpool: queue is full")
+	// ErrStopped is returned by Submit once the pool has been stopped.
+	ErrStopped = errors.New("workerpool: pool is stopped")
+)
+
+// QueuePolicy decides what Submit does when the queue is full.
+type QueuePolicy int
+
+const (
+	Block  QueuePolicy = iota // Wait until there is room in the queue (default)
+	Drop                      // Discard the task and return nil
+	Reject                    // Discard the task and return ErrQueueFull
+)
+
+// HandlerFunc processes a task. The context is cancelled when the task timeout
+// expires, or when the pool is stopped and the stop deadline has passed.
+type HandlerFunc[T any] func(ctx context.Context, task T) error
+
+type config struct {
+	minWorkers  int
+	maxWorkers  int
+	idleTimeout time.Duration
+	queueSize   int
+	policy      QueuePolicy
+	taskTimeout time.Duration
+	logger      utils.Logger
+	stats       *stat.AtomicStats
+}
+
+// Option configures a Pool.
+type Option func(c *config)
+
+// WithWorkers sets a fixed number of workers. The default is 1.
+func WithWorkers(n int) Option {
+	return func(c *config) {
+		c.minWorkers = n
+		c.maxWorkers = n
+	}
+}
+
+// WithAutoscale keeps min workers running and adds workers up to max while tasks
+// are waiting in the queue. Added workers exit after being idle for idleTimeout.
+func WithAutoscale(min, max int, idleTimeout time.Duration) Option {
+	return func(c *config) {
+		c.minWorkers = min
+		c.maxWorkers = max
+		c.idleTimeout = idleTimeout
+	}
+}
+
+// WithQueueSize sets the number of tasks that can wait for a worker. The default is 100.
+func WithQueueSize(n int) Option {
+	return func(c *config) {
+		c.queueSize = n
+	}
+}
+
+// WithQueuePolicy sets what Submit does when the queue is full. The default is Block.
+func WithQueuePolicy(policy QueuePolicy) Option {
+	return func(c *config) {
+		c.policy = policy
+	}
+}
+
+// WithTaskTimeout cancels the context passed to the handler after timeout.
+// The default of 0 means no timeout.
+func WithTaskTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.taskTimeout = timeout
+	}
+}
+
+// WithLogger sets the logger used to report failed tasks. The default logs to slog.Default().
+func WithLogger(logger utils.Logger) Option {
+	return func(c *config) {
+		c.logger = logger
+	}
+}
+
+// WithStats records task latencies in stats instead of a new AtomicStats, see Pool.Stats.
+func WithStats(stats *stat.AtomicStats) Option {
+	return func(c *config) {
+		c.stats = stats
+	}
+}
+
+type queuedTask[T any] struct {
+	task   T
+	queued time.Time
+}
+
+// Pool processes tasks submitted with Submit using a pool of workers.
+// Workers are started by Start and keep running until Stop is called, so that
+// tasks still in the queue are processed when the ServiceManager shuts down.
+type Pool[T any] struct {
+	handler HandlerFunc[T]
+	config  config
+	queue   chan queuedTask[T]
+	depth   *stat.Gauge
+
+	mu      sync.RWMutex
+	started bool
+	stopped bool
+	closing chan struct{}
+	once    sync.Once
+
+	workers   int
+	workersMu sync.Mutex
+	wg        sync.WaitGroup
+
+	baseCtx    context.Context
+	baseCancel context.CancelFunc
+
+	aborted   atomic.Bool // Set when Stop gave up waiting for the queue to drain
+	dropped   atomic.Int64
+	discarded atomic.Int64
+	panics    atomic.Int64
+}
+
+// New creates a Pool that calls handler for every submitted task.
+func New[T any](handler HandlerFunc[T], opts ...Option) *Pool[T] {
+	c := config{
+		minWorkers: 1,
+		maxWorkers: 1,
+		queueSize:  100,
+	}
+
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	if c.minWorkers < 1 {
+		c.minWorkers = 1
+	}
+
+	if c.maxWorkers < c.minWorkers {
+		c.maxWorkers = c.minWorkers
+	}
+
+	if c.queueSize < 0 {
+		c.queueSize = 0
+	}
+
+	if c.logger == nil {
+		c.logger = utils.NewSlogLogger(slog.Default().With("component", "workerpool"))
+	}
+
+	if c.stats == nil {
+		c.stats = stat.NewAtomicStats()
+	}
+
+	baseCtx, baseCancel := context.WithCancel(context.Background())
+
+	return &Pool[T]{
+		handler:    handler,
+		config:     c,
+		queue:      make(chan queuedTask[T], c.queueSize),
+		depth:      stat.NewGauge(),
+		closing:    make(chan struct{}),
+		baseCtx:    baseCtx,
+		baseCancel: baseCancel,
+	}
+}
+
+// Submit queues a task. When the queue is full, Submit blocks, drops the task or
+// returns ErrQueueFull depending on the queue policy. A blocked Submit returns
+// ctx.Err() if ctx is done first. Tasks can be submitted before Start is called,
+// in which case they wait in the queue.
+func (p *Pool[T]) Submit(ctx context.Context, task T) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.stopped {
+		return ErrStopped
+	}
+
+	qt := queuedTask[T]{task: task, queued: time.Now()}
+
+	select {
+	case p.queue <- qt:
+		p.queued()
+		return nil
+	default:
+	}
+
+	switch p.config.policy {
+	case Drop:
+		p.dropped.Add(1)
+		return nil
+	case Reject:
+		return ErrQueueFull
+	}
+
+	select {
+	case p.queue <- qt:
+		p.queued()
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.closing:
+		return ErrStopped
+	}
+}
+
+// queued is called by Submit, with p.mu held, after a task has been queued.
+func (p *Pool[T]) queued() {
+	p.depth.Add(1)
+
+	if p.started {
+		p.scale()
+	}
+}
+
+// scale adds a worker when autoscaling is enabled, tasks are waiting and the
+// maximum number of workers has not been reached.
+func (p *Pool[T]) scale() {
+	if p.config.maxWorkers == p.config.minWorkers || len(p.queue) == 0 {
+		return
+	}
+
+	p.workersMu.Lock()
+	defer p.workersMu.Unlock()
+
+	if p.workers < p.config.maxWorkers {
+		p.startWorker(p.config.idleTimeout)
+	}
+}
+
+// startWorker starts a worker that exits after idleTimeout without tasks, or only
+// when the queue is closed if idleTimeout is 0. The caller must hold workersMu.
+func (p *Pool[T]) startWorker(idleTimeout time.Duration) {
+	p.workers++
+	p.wg.Add(1)
+
+	go func() {
+		defer p.wg.Done()
+		p.work(idleTimeout)
+	}()
+}
+
+func (p *Pool[T]) work(idleTimeout time.Duration) {
+	var idle <-chan time.Time
+
+	for {
+		if idleTimeout > 0 {
+			idle = time.After(idleTimeout)
+		}
+
+		select {
+		case qt, ok := <-p.queue:
+			if !ok {
+				p.exitWorker()
+				return
+			}
+
+			p.process(qt)
+
+		case <-idle:
+			p.exitWorker()
+			return
+		}
+	}
+}
+
+func (p *Pool[T]) exitWorker() {
+	p.workersMu.Lock()
+	defer p.workersMu.Unlock()
+
+	p.workers--
+}
+
+func (p *Pool[T]) process(qt queuedTask[T]) {
+	p.depth.Add(-1)
+
+	if p.aborted.Load() {
+		p.discarded.Add(1)
+		return
+	}
+
+	start := time.Now()
+	p.config.stats.AddDuration("queued", start.Sub(qt.queued))
+
+	ctx := p.baseCtx
+
+	if p.config.taskTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.config.taskTimeout)
+		defer cancel()
+	}
+
+	err := p.safeHandle(ctx, qt.task)
+
+	duration := time.Since(start)
+
+	switch {
+	case err == nil:
+		p.config.stats.AddDuration("processed", duration)
+	case errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil:
+		p.config.logger.Warnf("Task timed out after %s", duration)
+		p.config.stats.AddDuration("timed out", duration)
+	default:
+		p.config.logger.Warnf("Task failed: %v", err)
+		p.config.stats.AddDuration("failed", duration)
+	}
+}
+
+// safeHandle calls the handler and turns a panic into an error, so that one task
+// cannot take down the process.
+func (p *Pool[T]) safeHandle(ctx context.Context, task T) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.panics.Add(1)
+			p.config.logger.Errorf("Task panicked: %v\n%s", r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return p.handler(ctx, task)
+}
+
+// QueueDepth returns the number of tasks waiting for a worker, and the highest
+// number that has been waiting.
+func (p *Pool[T]) QueueDepth() *stat.Gauge {
+	return p.depth
+}
+
+// Stats returns the time tasks spent in the queue under "queued", and the time
+// taken to process them under "processed", "failed" or "timed out".
+func (p *Pool[T]) Stats() *stat.AtomicStats {
+	return p.config.stats
+}
+
+// Workers returns the number of running workers.
+func (p *Pool[T]) Workers() int {
+	p.workersMu.Lock()
+	defer p.workersMu.Unlock()
+
+	return p.workers
+}
+
+// Dropped returns the number of tasks discarded by the Drop queue policy.
+func (p *Pool[T]) Dropped() int64 {
+	return p.dropped.Load()
+}
+
+// Discarded returns the number of queued tasks that were not processed because
+// Stop gave up waiting for the queue to drain.
+func (p *Pool[T]) Discarded() int64 {
+	return p.discarded.Load()
+}
+
+// Panics returns the number of tasks whose handler panicked.
+func (p *Pool[T]) Panics() int64 {
+	return p.panics.Load()
+}
+
+func (p *Pool[T]) Init(ctx context.Context) error {
+	return nil
+}
+
+// Start starts the workers and returns when ctx is done. The workers keep
+// processing the queue until Stop is called.
+func (p *Pool[T]) Start(ctx context.Context) error {
+	p.mu.Lock()
+
+	if p.stopped {
+		p.mu.Unlock()
+		return ErrStopped
+	}
+
+	if !p.started {
+		p.started = true
+
+		p.workersMu.Lock()
+		for i := 0; i < p.config.minWorkers; i++ {
+			p.startWorker(0)
+		}
+		p.workersMu.Unlock()
+	}
+
+	// Tasks submitted before Start may need more than the minimum workers
+	p.scale()
+	p.mu.Unlock()
+
+	<-ctx.Done()
+
+	return nil
+}
+
+// Stop stops accepting tasks and waits for the workers to process the tasks in the
+// queue. If ctx is done first, the context passed to running handlers is cancelled,
+// the remaining tasks are discarded and ctx.Err() is returned.
+func (p *Pool[T]) Stop(ctx context.Context) error {
+	p.once.Do(func() {
+		// Wake blocked submitters before waiting for them to release the lock
+		close(p.closing)
+
+		p.mu.Lock()
+		p.stopped = true
+		started := p.started
+		p.mu.Unlock()
+
+		close(p.queue)
+
+		if !started {
+			// There are no workers to process the queue
+			p.aborted.Store(true)
+
+			for qt := range p.queue {
+				p.process(qt)
+			}
+		}
+	})
+
+	done := make(chan struct{})
+
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.baseCancel()
+		return nil
+	case <-ctx.Done():
+		p.aborted.Store(true)
+		p.baseCancel()
+		return ctx.Err()
+	}
+}
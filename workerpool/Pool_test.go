@@ -0,0 +1,204 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ordishs/go-utils"
+	"github.com/ordishs/go-utils/servicemanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ servicemanager.Service = (*Pool[any])(nil)
+
+func start[T any](t *testing.T, p *Pool[T]) context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		assert.NoError(t, p.Start(ctx))
+	}()
+
+	require.Eventually(t, func() bool {
+		return p.Workers() > 0
+	}, time.Second, time.Millisecond)
+
+	return cancel
+}
+
+func TestPoolDrainsOnStop(t *testing.T) {
+	var processed atomic.Int32
+
+	p := New(func(ctx context.Context, n int) error {
+		time.Sleep(time.Millisecond)
+		processed.Add(1)
+		return nil
+	}, WithWorkers(4), WithQueueSize(100), WithLogger(utils.NopLogger{}))
+
+	for i := 0; i < 50; i++ {
+		require.NoError(t, p.Submit(context.Background(), i))
+	}
+
+	cancel := start(t, p)
+	cancel()
+
+	require.NoError(t, p.Stop(context.Background()))
+
+	assert.Equal(t, int32(50), processed.Load())
+	assert.Equal(t, int64(0), p.QueueDepth().Get())
+	assert.Equal(t, int64(50), p.QueueDepth().GetMax())
+	assert.Equal(t, int32(50), p.Stats().GetMap()["processed"].GetCount())
+
+	assert.ErrorIs(t, p.Submit(context.Background(), 1), ErrStopped)
+}
+
+func TestPoolQueuePolicies(t *testing.T) {
+	release := make(chan struct{})
+
+	handler := func(ctx context.Context, n int) error {
+		<-release
+		return nil
+	}
+
+	drop := New(handler, WithQueueSize(1), WithQueuePolicy(Drop), WithLogger(utils.NopLogger{}))
+	reject := New(handler, WithQueueSize(1), WithQueuePolicy(Reject), WithLogger(utils.NopLogger{}))
+	block := New(handler, WithQueueSize(1), WithLogger(utils.NopLogger{}))
+
+	for _, p := range []*Pool[int]{drop, reject, block} {
+		require.NoError(t, p.Submit(context.Background(), 1))
+	}
+
+	require.NoError(t, drop.Submit(context.Background(), 2))
+	assert.Equal(t, int64(1), drop.Dropped())
+
+	assert.ErrorIs(t, reject.Submit(context.Background(), 2), ErrQueueFull)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.ErrorIs(t, block.Submit(ctx, 2), context.DeadlineExceeded)
+
+	// A blocked Submit returns when the pool is stopped
+	blocked := make(chan error)
+
+	go func() {
+		blocked <- block.Submit(context.Background(), 3)
+	}()
+
+	// The submitter holds the read lock while it waits for space in the queue
+	require.Eventually(t, func() bool {
+		if block.mu.TryLock() {
+			block.mu.Unlock()
+			return false
+		}
+
+		return true
+	}, time.Second, time.Millisecond)
+
+	close(release)
+
+	require.NoError(t, block.Stop(context.Background()))
+	assert.ErrorIs(t, <-blocked, ErrStopped)
+
+	// Tasks queued before Start are discarded when the pool was never started
+	assert.Equal(t, int64(1), block.Discarded())
+}
+
+func TestPoolTimeoutsAndPanics(t *testing.T) {
+	p := New(func(ctx context.Context, n int) error {
+		switch n {
+		case 0:
+			<-ctx.Done()
+			return ctx.Err()
+		case 1:
+			panic("oops")
+		default:
+			return errors.New("failed")
+		}
+	}, WithTaskTimeout(10*time.Millisecond), WithLogger(utils.NopLogger{}))
+
+	cancel := start(t, p)
+	defer cancel()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, p.Submit(context.Background(), i))
+	}
+
+	require.NoError(t, p.Stop(context.Background()))
+
+	stats := p.Stats().GetMap()
+	assert.Equal(t, int32(1), stats["timed out"].GetCount())
+	assert.Equal(t, int32(2), stats["failed"].GetCount())
+	assert.Equal(t, int64(1), p.Panics())
+}
+
+func TestPoolAutoscale(t *testing.T) {
+	release := make(chan struct{})
+
+	var running, maxRunning atomic.Int32
+
+	p := New(func(ctx context.Context, n int) error {
+		r := running.Add(1)
+		defer running.Add(-1)
+
+		for {
+			m := maxRunning.Load()
+			if r <= m || maxRunning.CompareAndSwap(m, r) {
+				break
+			}
+		}
+
+		<-release
+
+		return nil
+	}, WithAutoscale(1, 4, 20*time.Millisecond), WithLogger(utils.NopLogger{}))
+
+	cancel := start(t, p)
+	defer cancel()
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, p.Submit(context.Background(), i))
+	}
+
+	assert.Eventually(t, func() bool {
+		return running.Load() == 4
+	}, time.Second, time.Millisecond)
+
+	close(release)
+
+	// Extra workers exit when they are idle
+	assert.Eventually(t, func() bool {
+		return p.Workers() == 1
+	}, time.Second, 5*time.Millisecond)
+
+	assert.Equal(t, int32(4), maxRunning.Load())
+
+	require.NoError(t, p.Stop(context.Background()))
+	assert.Equal(t, 0, p.Workers())
+}
+
+func TestPoolStopDeadline(t *testing.T) {
+	p := New(func(ctx context.Context, n int) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, WithLogger(utils.NopLogger{}))
+
+	cancel := start(t, p)
+	defer cancel()
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, p.Submit(context.Background(), i))
+	}
+
+	ctx, stopCancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer stopCancel()
+
+	assert.ErrorIs(t, p.Stop(ctx), context.DeadlineExceeded)
+
+	assert.Eventually(t, func() bool {
+		return p.Discarded() == 4
+	}, time.Second, time.Millisecond)
+}